@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/*
+	金额：
+		所有金额以最小单位的整数表示（1个币 = 10^8个最小单位），避免浮点数运算的精度误差。
+		用户输入和输出时使用十进制字符串，如"1.25"。
+*/
+
+//Amount 金额（最小单位的个数）
+type Amount int64
+
+const (
+	//AmountDecimals 金额的小数位数
+	AmountDecimals = 8
+	//CoinUnit 1个币包含的最小单位个数
+	CoinUnit Amount = 100000000
+	//MaxMoney 单个金额的上限（所有网络共用，不小于任何网络的货币总量，见GetMaxSupply）
+	MaxMoney Amount = 21000000 * CoinUnit
+)
+
+//金额错误
+var (
+	ErrAmountFormat   = errors.New("金额格式错误")
+	ErrAmountOverflow = errors.New("金额溢出")
+	ErrAmountRange    = errors.New("金额超出范围")
+)
+
+//ParseAmount 将十进制字符串（如"1.25"）解析为金额，最多8位小数，不能为负数
+func ParseAmount(s string) (Amount, error) {
+	intPart, fracPart := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	if len(intPart) == 0 && len(fracPart) == 0 {
+		return 0, ErrAmountFormat
+	}
+	if len(fracPart) > AmountDecimals {
+		return 0, ErrAmountFormat
+	}
+	//只允许数字，不允许符号和空格
+	for _, c := range intPart + fracPart {
+		if c < '0' || c > '9' {
+			return 0, ErrAmountFormat
+		}
+	}
+
+	//整数部分
+	var coins uint64
+	if len(intPart) != 0 {
+		var err error
+		coins, err = strconv.ParseUint(intPart, 10, 64)
+		if err != nil || coins > uint64(MaxMoney/CoinUnit) {
+			return 0, ErrAmountRange
+		}
+	}
+	//小数部分补齐8位
+	var units uint64
+	if len(fracPart) != 0 {
+		fracPart += strings.Repeat("0", AmountDecimals-len(fracPart))
+		units, _ = strconv.ParseUint(fracPart, 10, 64)
+	}
+
+	amount := Amount(coins)*CoinUnit + Amount(units)
+	if !amount.IsValid() {
+		return 0, ErrAmountRange
+	}
+	return amount, nil
+}
+
+//String 将金额格式化为十进制字符串（去掉小数末尾的0）
+func (a Amount) String() string {
+	sign := ""
+	u := uint64(a)
+	if a < 0 {
+		sign = "-"
+		u = uint64(-a)
+	}
+	coins := u / uint64(CoinUnit)
+	units := u % uint64(CoinUnit)
+	if units == 0 {
+		return sign + strconv.FormatUint(coins, 10)
+	}
+	frac := strconv.FormatUint(units, 10)
+	frac = strings.Repeat("0", AmountDecimals-len(frac)) + frac
+	return sign + strconv.FormatUint(coins, 10) + "." + strings.TrimRight(frac, "0")
+}
+
+//IsValid 判断金额是否在有效范围内（0到MaxMoney）
+func (a Amount) IsValid() bool {
+	return a >= 0 && a <= MaxMoney
+}
+
+//AddAmount 金额相加，溢出时返回错误
+func AddAmount(a Amount, b Amount) (Amount, error) {
+	sum := a + b
+	//同号相加结果变号即为溢出
+	if (a > 0 && b > 0 && sum < 0) || (a < 0 && b < 0 && sum >= 0) {
+		return 0, ErrAmountOverflow
+	}
+	return sum, nil
+}
+
+//SubAmount 金额相减，溢出时返回错误
+func SubAmount(a Amount, b Amount) (Amount, error) {
+	if b == -b && b != 0 { //最小的负数取反仍为自身
+		return 0, ErrAmountOverflow
+	}
+	return AddAmount(a, -b)
+}
+
+//MulAmount 金额乘以个数，溢出时返回错误
+func MulAmount(a Amount, n uint64) (Amount, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	if a < 0 || uint64(a) > math.MaxInt64/n {
+		return 0, ErrAmountOverflow
+	}
+	return a * Amount(n), nil
+}
@@ -2,8 +2,6 @@ package main
 
 import (
 	"bytes"
-	"crypto/sha256"
-	"encoding/gob"
 	"fmt"
 	"time"
 )
@@ -11,6 +9,7 @@ import (
 //Block 区块
 type Block struct {
 	Version      uint64         //版本号
+	Height       uint64         //区块高度（创世块为0，不参与哈希计算）
 	PrevHash     []byte         //前区块哈希值
 	MerkleRoot   []byte         //梅克尔根（交易的根哈希值）
 	TimeStamp    uint64         //时间戳
@@ -20,14 +19,20 @@ type Block struct {
 	Transactions []*Transaction //区块数据：区块的交易集合
 }
 
-//NewBlock 创建一个区块(传入交易和前区块的哈希)
-func NewBlock(txs []*Transaction, prevHash []byte) *Block {
+//NewBlock 创建一个区块(传入交易、前区块的哈希、区块高度、需要满足的难度和时间戳下限)
+func NewBlock(txs []*Transaction, prevHash []byte, height uint64, bits uint64, minTimeStamp uint64) *Block {
+	//时间戳必须大于最近11个区块时间戳的中位数（本地时钟回拨时使用下限）
+	timeStamp := uint64(time.Now().UnixNano())
+	if timeStamp < minTimeStamp {
+		timeStamp = minTimeStamp
+	}
 	b := Block{
-		Version:      0,
+		Version:      BlockVersion,
+		Height:       height,
 		PrevHash:     prevHash,
 		MerkleRoot:   nil,
-		TimeStamp:    uint64(time.Now().UnixNano()),
-		Bits:         0,
+		TimeStamp:    timeStamp,
+		Bits:         bits,
 		Nonce:        0,
 		Hash:         nil,
 		Transactions: txs,
@@ -45,55 +50,38 @@ func NewBlock(txs []*Transaction, prevHash []byte) *Block {
 	return &b
 }
 
-//Serialize 将区块数据序列化为字节流的方法
+//Serialize 将区块数据序列化为字节流的方法（格式见serialize.go）
 func (b *Block) Serialize() []byte {
 	//定义buffer容器
 	var buffer bytes.Buffer
-	//创建编码器
-	encoder := gob.NewEncoder(&buffer)
-	//编码
-	err := encoder.Encode(b)
-	if err != nil {
-		fmt.Println(err)
-		return nil
+	//区块头
+	buffer.Write(b.serializeHeader(b.Nonce))
+	//高度和哈希
+	writeUint64(&buffer, b.Height)
+	writeVarBytes(&buffer, b.Hash)
+	//交易
+	writeVarInt(&buffer, uint64(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		tx.encode(&buffer)
 	}
-	//得字节流
-	data := buffer.Bytes()
-	return data
+	return buffer.Bytes()
 }
 
 //DeSerialize 将字节流反序列化为区块数据
 func DeSerialize(data []byte) *Block {
-
-	//定义一个区块
-	var block Block
-
-	//创建解码器
-	decoder := gob.NewDecoder(bytes.NewReader(data))
-
-	//解码
-	err := decoder.Decode(&block)
+	r := bytes.NewReader(data)
+	block, err := decodeBlock(r)
+	if err == nil {
+		err = checkTrailing(r)
+	}
 	if err != nil {
 		fmt.Println(err)
 		return nil
 	}
-
-	return &block
+	return block
 }
 
-//HashTransactionMerkleRoot 简易的梅克尔根，把所有交易拼接后计算哈希值
+//HashTransactionMerkleRoot 由所有交易ID构建梅克尔树，将梅克尔根赋值给MerkleRoot
 func (b *Block) HashTransactionMerkleRoot() {
-
-	var info [][]byte
-	//遍历所有交易并计算哈希值
-	for _, tx := range b.Transactions {
-		//将所有的哈希值拼接后再计算哈希值
-		txHash := tx.TXID
-		info = append(info, txHash)
-	}
-	//拼接字符切片
-	value := bytes.Join(info, []byte{})
-	hash := sha256.Sum256(value)
-	//将最终的哈希值赋值给MerKleRoot
-	b.MerkleRoot = hash[:]
+	b.MerkleRoot = ComputeMerkleRoot(b.txids())
 }
@@ -2,9 +2,9 @@ package main
 
 import (
 	"bytes"
-	"crypto/ecdsa"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/boltdb/bolt"
 )
@@ -19,25 +19,32 @@ type BlockChain struct {
 //创世语
 const genesisInfo = "I am alpha."
 
-//数据库名
-const blockChainDBFile = "blockchain.db"
-
 //数据桶
 const blockBucket = "blockBucket"
 
 //数据桶中保存最后一个区块哈希值的字段key
 const lastBlockHashKey = "lastBlockHashKey"
 
+//数据桶中保存数据库格式版本的字段key（没有该字段的是旧的gob格式数据库）
+const dbFormatKey = "dbFormatKey"
+
+//数据桶中保存签名方案名称的字段key（没有该字段的数据库由使用P256的旧版本创建）
+const dbSchemeKey = "dbSchemeKey"
+
+//当前的数据库格式版本：区块、UTXO和内存池交易使用serialize.go中的二进制格式，output使用锁定脚本
+//版本1为没有脚本的二进制格式
+const dbFormatVersion = 2
+
 //CreateBlockChain 创建区块链（同时添加创世块）
 func CreateBlockChain(address string) error {
 
 	//判断区块链是否存在
-	if IsFileExist(blockChainDBFile) {
+	if IsFileExist(activeNetParams.DBFile) {
 		return errors.New("区块链文件已存在")
 	}
 
 	//打开数据库，没有则创建
-	db, err := bolt.Open(blockChainDBFile, 0600, nil)
+	db, err := bolt.Open(activeNetParams.DBFile, 0600, nil)
 	if err != nil {
 		fmt.Println(err)
 		return err
@@ -51,20 +58,37 @@ func CreateBlockChain(address string) error {
 		//如果数据桶不存在则创建
 		if bucket == nil {
 			//创建数据桶
-			bucket, err := tx.CreateBucket([]byte(blockBucket))
+			_, err := tx.CreateBucket([]byte(blockBucket))
 			if err != nil {
 				return err
 			}
 			//创建挖矿交易
-			coinbase := NewCoinbaseTX(address, genesisInfo)
+			coinbase := NewCoinbaseTX(address, genesisInfo, 0, 0)
 			//拼装交易集合txs
 			txs := []*Transaction{coinbase}
 			//新建创世快
-			genesisBlock := NewBlock(txs, nil)
-			//将区块数据流写入数据库（key为区块的哈希，value为区块的数据流）
-			bucket.Put(genesisBlock.Hash, genesisBlock.Serialize())
-			//将最后一个区块的哈希写入数据库（key为lastBlockHash,value为创世块的哈希）
-			bucket.Put([]byte(lastBlockHashKey), genesisBlock.Hash)
+			genesisBlock := NewBlock(txs, nil, 0, activeNetParams.PowLimitBits, 0)
+			//创建各个索引数据桶
+			for _, name := range []string{utxoBucket, txIndexBucket, heightBucket, mempoolBucket} {
+				_, err := tx.CreateBucketIfNotExists([]byte(name))
+				if err != nil {
+					return err
+				}
+			}
+			//写入创世块并更新索引
+			err = writeBlock(tx, genesisBlock)
+			if err != nil {
+				return err
+			}
+			//记录数据库格式版本和签名方案
+			err = tx.Bucket([]byte(blockBucket)).Put([]byte(dbFormatKey), UintToByteSlice(dbFormatVersion))
+			if err != nil {
+				return err
+			}
+			err = tx.Bucket([]byte(blockBucket)).Put([]byte(dbSchemeKey), []byte(activeNetParams.Scheme.Name()))
+			if err != nil {
+				return err
+			}
 			fmt.Println("创建区块链成功")
 		} else {
 			fmt.Println("区块链已存在")
@@ -78,7 +102,7 @@ func CreateBlockChain(address string) error {
 //GetBlockChainInstance 获取区块链实例
 func GetBlockChainInstance() (*BlockChain, error) {
 	//判断区块链是否存在
-	if !IsFileExist(blockChainDBFile) {
+	if !IsFileExist(activeNetParams.DBFile) {
 		return nil, errors.New("区块链文件不存在")
 	}
 
@@ -86,7 +110,7 @@ func GetBlockChainInstance() (*BlockChain, error) {
 	var lastHash []byte
 
 	//打开数据库
-	db, err := bolt.Open(blockChainDBFile, 0600, nil)
+	db, err := bolt.Open(activeNetParams.DBFile, 0600, nil)
 	if err != nil {
 		fmt.Println(err)
 		return nil, err
@@ -94,62 +118,186 @@ func GetBlockChainInstance() (*BlockChain, error) {
 	//不关闭数据库
 
 	//查询数据库事务
-	db.View(func(tx *bolt.Tx) error {
+	err = db.View(func(tx *bolt.Tx) error {
 		//打开数据桶
 		bucket := tx.Bucket([]byte(blockBucket))
 		if bucket == nil {
 			return errors.New("No bucket")
 		}
-		//从数据桶获取最后一个区块的哈希值
-		lastHash = bucket.Get([]byte(lastBlockHashKey))
+		//旧格式的数据库需要先转换
+		format := bucket.Get([]byte(dbFormatKey))
+		if format == nil {
+			return errors.New("数据库为旧的gob格式，请先执行migratedb")
+		}
+		if !bytes.Equal(format, UintToByteSlice(dbFormatVersion)) {
+			return errors.New("数据库为旧版本的格式，请先执行migratedb")
+		}
+		//签名方案必须与创建区块链时一致（SelectScheme已检查，这里防止绕过）
+		if scheme := storedScheme(bucket); scheme != activeNetParams.Scheme.Name() {
+			return fmt.Errorf("区块链使用%s签名方案，当前为%s", scheme, activeNetParams.Scheme.Name())
+		}
+		//从数据桶获取最后一个区块的哈希值（数据只在事务内有效，需要复制）
+		lastHash = append([]byte{}, bucket.Get([]byte(lastBlockHashKey))...)
 		return nil
 	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 
 	//返回区块链实例
 	bc := BlockChain{db, lastHash}
 	return &bc, nil
 }
 
+//storedScheme 数据桶中记录的签名方案名称
+func storedScheme(bucket *bolt.Bucket) string {
+	scheme := bucket.Get([]byte(dbSchemeKey))
+	if scheme == nil {
+		return SchemeP256
+	}
+	return string(scheme)
+}
+
+//ReadDBScheme 读取区块链数据库记录的签名方案，数据库不存在时返回空字符串
+func ReadDBScheme(dbFile string) (string, error) {
+	if !IsFileExist(dbFile) {
+		return "", nil
+	}
+	//只读打开，不阻塞同时运行的其他只读命令
+	db, err := bolt.Open(dbFile, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	var scheme string
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(blockBucket))
+		if bucket != nil {
+			scheme = storedScheme(bucket)
+		}
+		return nil
+	})
+	return scheme, err
+}
+
 //AddBlock 向区块链中添加区块的方法（传入数据：交易集合）
-func (bc *BlockChain) AddBlock(txs0 []*Transaction) error {
-	//有效的交易集合
-	txs := []*Transaction{}
-
-	//校验交易签名
-	for _, tx := range txs0 {
-		if bc.VerifyTransaction(tx) {
-			txs = append(txs, tx)
+func (bc *BlockChain) AddBlock(txs []*Transaction) error {
+	//按区块内的顺序校验交易（挖矿交易由区块校验检查），任何一笔无效都返回错误，不创建区块
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		view, err := newUTXOView(tx)
+		if err != nil {
+			return err
 		}
+		for _, transaction := range txs {
+			if transaction.isCoinBaseTX() {
+				continue
+			}
+			_, err := validateTransaction(tx, view, transaction)
+			if err != nil {
+				return fmt.Errorf("交易%x: %w", transaction.TXID, err)
+			}
+			view.apply(transaction)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	//获取最后一个区块的哈希
+	//获取最后一个区块的哈希和高度
 	lastBlockHash := bc.tail
+	lastHeight, err := bc.GetBestHeight()
+	if err != nil {
+		return err
+	}
+	//新区块需要满足的难度
+	bits, err := bc.GetNextBits()
+	if err != nil {
+		return err
+	}
+	//新区块的时间戳必须大于最近11个区块时间戳的中位数
+	median, err := bc.GetMedianTimestamp()
+	if err != nil {
+		return err
+	}
 
 	//创建一个新区块
-	newBlock := NewBlock(txs, lastBlockHash)
+	newBlock := NewBlock(txs, lastBlockHash, lastHeight+1, bits, median+1)
+
+	//校验并写入数据库
+	err = bc.AcceptBlock(newBlock)
+	if err != nil {
+		return err
+	}
+	fmt.Println("添加区块成功")
+	return nil
+}
 
-	//写入数据库
+//AcceptBlock 校验区块并写入数据库：本地挖出的区块和从其他节点收到的区块都必须经过这里
+func (bc *BlockChain) AcceptBlock(block *Block) error {
 	err := bc.db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(blockBucket))
-		if bucket == nil {
-			return errors.New("No bucket")
-		}
-		//写入新区块到数据库（key为区块的哈希，value为区块的数据字节流）
-		err := bucket.Put(newBlock.Hash, newBlock.Serialize())
-		if err != nil {
-			return err
-		}
-		//更新lastBlockHashKey（数据库中记录最后一个区块哈希的值）
-		err = bucket.Put([]byte(lastBlockHashKey), newBlock.Hash)
+		//校验共识规则
+		err := validateBlock(tx, bc.tail, block)
 		if err != nil {
 			return err
 		}
-		//更新区块链的tali值（最后一个区块的哈希值）
-		bc.tail = newBlock.Hash
-		fmt.Println("添加区块成功")
-		return nil
+		return writeBlock(tx, block)
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	//更新区块链的tail值（最后一个区块的哈希值）
+	bc.tail = block.Hash
+	return nil
+}
+
+//writeBlock 在数据库事务中写入区块，并更新最后区块哈希、UTXO集、交易索引、高度索引和内存池
+func writeBlock(tx *bolt.Tx, block *Block) error {
+	bucket := tx.Bucket([]byte(blockBucket))
+	if bucket == nil {
+		return errors.New("No bucket")
+	}
+	//写入新区块到数据库（key为区块的哈希，value为区块的数据字节流）
+	err := bucket.Put(block.Hash, block.Serialize())
+	if err != nil {
+		return err
+	}
+	//更新lastBlockHashKey（数据库中记录最后一个区块哈希的值）
+	err = bucket.Put([]byte(lastBlockHashKey), block.Hash)
+	if err != nil {
+		return err
+	}
+	//更新UTXO集（与区块在同一个事务中写入）
+	utxos := tx.Bucket([]byte(utxoBucket))
+	if utxos == nil {
+		return errors.New("UTXO集不存在，请执行reindexutxo")
+	}
+	err = updateUTXOSet(utxos, block)
+	if err != nil {
+		return err
+	}
+	//更新交易索引
+	txIndex := tx.Bucket([]byte(txIndexBucket))
+	if txIndex == nil {
+		return errors.New("交易索引不存在，请执行reindextx")
+	}
+	err = updateTXIndex(txIndex, block)
+	if err != nil {
+		return err
+	}
+	//更新高度索引
+	heights := tx.Bucket([]byte(heightBucket))
+	if heights == nil {
+		return errors.New("高度索引不存在，请执行reindexheight")
+	}
+	err = updateHeightIndex(heights, block)
+	if err != nil {
+		return err
+	}
+	//将已上链和冲突的交易移出内存池
+	return removeBlockFromMempool(tx, block)
 }
 
 //Iterator 迭代器（用于实现区块遍历）
@@ -190,99 +338,34 @@ func (it *Iterator) Next() (block *Block) {
 	return
 }
 
-//UTXOInfo UTXO详情
-type UTXOInfo struct {
-	TXID     []byte //交易ID
-	Index    int64  //索引值
-	TXOutput        //继承自output
-}
+//findSpendableUTXO 查询UTXO集，找到锁定脚本为script的utxo（不包括已被内存池中的交易消耗的utxo）
+func (bc *BlockChain) findSpendableUTXO(script []byte) []UTXOInfo {
+	var spendable []UTXOInfo
 
-//FindMyUTXO 获取指定地址的金额：遍历账本
-func (bc *BlockChain) FindMyUTXO(pubKeyHash []byte) []UTXOInfo {
-	var utxoInfos []UTXOInfo                //UTXO集合
-	var spentUtxos = make(map[string][]int) //定义一个存放已消耗交易输出集合的集合
-
-	it := bc.NewIterator() //定义迭代器
-
-	for {
-		//遍历区块
-		block := it.Next()
-		//遍历交易
-		for _, tx := range block.Transactions {
-		LABEL:
-			//遍历outputs，判断其锁定脚本是否为目标地址
-			for outputIndex, output := range tx.TXOutputs {
-				//判断与付款人有关的UTXO
-				if bytes.Equal(output.ScriptPubKeyHash, pubKeyHash) { //对比两个哈希是否相同
-					//过滤
-					currentTXID := string(tx.TXID)
-					//在集合中查找集合
-					indexArray := spentUtxos[currentTXID]
-					//判断该交易ID是否有数据，有则代表已被某个output使用
-					if len(indexArray) != 0 {
-						for _, spendIndex := range indexArray {
-							//判断下标
-							if outputIndex == spendIndex {
-								continue LABEL
-							}
-						}
-
-					}
-					//找到属于目标地址的utxo详情
-					utxoInfo := UTXOInfo{tx.TXID, int64(outputIndex), output}
-					utxoInfos = append(utxoInfos, utxoInfo)
-				}
-			}
-
-			//遍历inputs
-			if tx.isCoinBaseTX() { //判断是否为挖矿交易
-				continue //跳过循环，不遍历inputs
-			}
-			//遍历非挖矿交易inputs
-			for _, input := range tx.TXInputs {
-				//判断付款人的公钥哈希
-				if bytes.Equal(GetPubKeyHashFromPublicKey(input.PubKey), pubKeyHash) { //对比两个公钥哈希是否相等
-					//key交易ID，value为交易输出索引的集合
-					spentKey := string(input.TXID)
-					//向集合中添加已消耗交易输出的集合
-					spentUtxos[spentKey] = append(spentUtxos[spentKey], int(input.Index))
-				}
-			}
-
-		}
-		//退出条件
-		if len(block.PrevHash) == 0 {
-			break
+	//查询UTXO集，找到所有utxo集合
+	utxoInfos := bc.FindMyUTXO(script)
+	//已被内存池中的交易消耗的utxo
+	mempoolSpent := bc.mempoolSpentOutputs()
+	for _, utxoInfo := range utxoInfos {
+		if mempoolSpent[string(utxoKey(utxoInfo.TXID, utxoInfo.Index))] {
+			continue
 		}
+		spendable = append(spendable, utxoInfo)
 	}
-	return utxoInfos
-
+	return spendable
 }
 
-//遍历账本（转账人地址，转账金额）找到from能使用的utxo集合及包含的所有金额
-func (bc *BlockChain) findNeedUTXO(pubKeyHash []byte, amount float64) (map[string][]int64, float64) {
-	var retMap = make(map[string][]int64)
-	var retValue float64
-
-	//遍历账本，找到所有utxo集合
-	utxoInfos := bc.FindMyUTXO(pubKeyHash)
-	//遍历utxo,统计总金额
-	for _, utxoInfo := range utxoInfos {
-		retValue += utxoInfo.Value                        //utxo总额
-		key := string(utxoInfo.TXID)                      //
-		retMap[key] = append(retMap[key], utxoInfo.Index) //将要使用的utxo集合
-		//如果总金额大于转账金额，直接返回
-		if retValue >= amount {
-			break
-		}
-		//否则继续遍历
+//查询UTXO集（转账人的锁定脚本，转账金额，选币策略）找到from将要使用的utxo集合及包含的所有金额
+func (bc *BlockChain) findNeedUTXO(script []byte, amount Amount, selector CoinSelector) ([]UTXOInfo, Amount, error) {
+	//交易至少需要一个input：只有数据output且没有手续费时至少选择1个最小单位
+	if amount == 0 {
+		amount = 1
 	}
-
-	return retMap, retValue
+	return selector.Select(bc.findSpendableUTXO(script), amount)
 }
 
-//SignTransaction 签名函数
-func (bc *BlockChain) SignTransaction(tx *Transaction, priKey *ecdsa.PrivateKey) bool {
+//SignTransaction 签名函数（signers为每个input对应的钱包）
+func (bc *BlockChain) SignTransaction(tx *Transaction, signers []*Wallet) bool {
 	//根据TX获取所有需要的prevTXs
 	prevTXs := make(map[string]*Transaction)
 	//遍历账本，找到所有需要的交易集合
@@ -297,29 +380,8 @@ func (bc *BlockChain) SignTransaction(tx *Transaction, priKey *ecdsa.PrivateKey)
 	}
 
 	//执行签名
-	return tx.Sign(priKey, prevTXs)
-
-}
+	return tx.Sign(signers, prevTXs)
 
-//FindTransaction 根据交易ID获取交易
-func (bc *BlockChain) FindTransaction(txid []byte) *Transaction {
-	//遍历区块和账本，比较txid和交易ID，如果相同则返回交易，否则返回nil
-
-	it := bc.NewIterator() //迭代器
-
-	for {
-		block := it.Next()
-		for _, tx := range block.Transactions {
-			//判断当前交易ID和要查找的ID是否相同
-			if bytes.Equal(tx.TXID, txid) {
-				return tx
-			}
-		}
-		if len(block.PrevHash) == 0 {
-			break
-		}
-	}
-	return nil
 }
 
 //VerifyTransaction 交易签名校验
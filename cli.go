@@ -1,9 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 //CLI 命令行(Command Line)
@@ -16,10 +19,54 @@ Usage:
 	create <address> "创建区块链"
 	getbalance <address> "获取地址对应的金额"
 	print "打印区块链" 
-	send <from> <to> <amount> <miner> <data> "转账：付款人 收款人 转账金额 矿工 数据"
-	createwallet "创建钱包"
-	listaddress "获取所有钱包地址"
+	send <from> <to> <amount> [--fee <amount>] [--strategy <name>] [--locktime <height|unixtime>] [--sequence <n>] "转账：付款人 收款人 转账金额 [手续费] [选币策略] [锁定时间] [input序号]，交易放入内存池"
+	sendmany <from> <addr:amount,...> [--fee <amount>] [--strategy <name>] "批量转账：付款人 收款人及金额列表 [手续费]，交易放入内存池"
+	sendfromwallet <to> <amount> [--fee <amount>] [--change <address>] [--strategy <name>] "从钱包中的任意地址转账，默认找零到HD钱包账户0的下一个找零地址（没有HD种子时找零给第一个付款地址）"
+	mine <miner> [data] "挖矿：从内存池按手续费率选择交易打包成区块"
+	mempool "打印内存池中的交易"
+	createwallet [--account <n> | --uncompressed] "创建钱包地址：默认从HD种子派生账户n（默认为0）的下一个收款地址，第一次使用时生成助记词；--uncompressed创建随机私钥，地址由未压缩格式的公钥计算"
+	restorewallet <mnemonic> "由助记词恢复HD钱包，遍历账本找回所有使用过的地址"
+	dumpprivkey <address> "导出地址的私钥（WIF格式）"
+	importprivkey <wif> [label] "导入WIF格式的私钥，遍历账本输出该地址的收支记录"
+	importaddress <address|pubkey> [label] "导入只读地址或公钥（没有私钥，不能签名），遍历账本输出该地址的收支记录"
+	listaddress "获取所有钱包地址（包括只读地址）"
+	getwalletbalance "查询钱包中每个地址的余额，可用余额、多重签名地址和只读地址的余额分开统计"
+	listtransactions "遍历账本输出钱包的收支记录，钱包地址、多重签名地址和只读地址分开输出"
+	encryptwallet "使用密码（从标准输入读取）加密钱包中的私钥，加密后签名和创建地址需要先解锁"
+	walletpassphrase <timeout> "输入密码解锁钱包，timeout秒后自动锁定"
+	walletlock "立即锁定钱包"
+	getpubkey <address> "输出钱包地址（或导入公钥的只读地址）的公钥，用于创建多重签名地址"
+	createmultisig <m> <pubkey1,pubkey2,...> "创建需要m个签名的多重签名地址，赎回脚本保存到钱包"
+	createmultisigtx <from> <to> <amount> <file> [--fee <amount>] [--strategy <name>] "从多重签名地址创建待签名的交易，写入文件"
+	signmultisigtx <file> "使用钱包中的私钥对文件中的交易签名"
+	sendmultisigtx <file> "签名足够后完成交易，校验通过后放入内存池"
+	notarize <from> <file> [--fee <amount>] [--strategy <name>] "文件存证：将文件的sha256哈希写入交易的数据output，交易放入内存池"
+	verifynotary <file> "查询文件哈希所在的交易和区块"
 	printtx "打印区块的所有交易"
+	reindexutxo "遍历账本重建UTXO集"
+	reindextx "遍历账本重建交易索引"
+	gettx <txid> "根据交易ID查询交易"
+	getblock <height|hash> "根据高度或哈希查询区块"
+	getblockhash <height> "根据高度查询区块哈希"
+	getblockcount "查询最后一个区块的高度"
+	reindexheight "遍历账本重建区块高度索引"
+	getmerkleproof <txid> "输出交易的梅克尔证明(JSON)"
+	supply "查询已发行货币、当前区块奖励和下一次减半的高度"
+	migratedb "将旧格式（gob或没有脚本的二进制格式）的数据库转换为当前格式"
+
+Strategy:
+	largest "从大到小选择utxo（默认）"
+	smallest "从小到大选择utxo，优先花掉零钱"
+	bnb "搜索总金额恰好等于转账金额+手续费的组合，不产生找零，找不到时使用largest"
+	random "随机选择utxo"
+
+Lock:
+	--locktime <height|unixtime> "小于500000000时为区块高度，否则为unix时间（秒），到达之前交易留在内存池"
+	--sequence <n> "input的序号：低16位为相对锁定的区块个数，加上4194304（第22位）时以512秒为单位"
+
+Environment:
+	BLOCKCHAIN_NET=mainnet|testnet|regtest "选择网络，默认为mainnet"
+	BLOCKCHAIN_SCHEME=secp256k1|p256 "创建区块链时选择签名方案，默认为secp256k1；已有区块链时使用数据库记录的签名方案（迁移的旧链为p256），设置时必须一致"
 `
 
 //Run 解析用户输入命令的方法
@@ -29,7 +76,7 @@ func (cli *CLI) Run() {
 	cmds := os.Args
 	if len(cmds) < 2 {
 		fmt.Println("请输入命令参数")
-		fmt.Println(Usage)
+		fmt.Print(Usage)
 		return
 	}
 
@@ -56,28 +103,441 @@ func (cli *CLI) Run() {
 		cli.getBalance(address)
 	case "send":
 		fmt.Println("转账")
-		if len(cmds) != 7 {
+		if len(cmds) < 5 {
 			fmt.Println("转账参数错误")
 			return
 		}
+		options, err := parseOptions(cmds[5:], "--fee", "--strategy", "--locktime", "--sequence")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
 		from := cmds[2]
 		to := cmds[3]
-		amount, _ := strconv.ParseFloat(cmds[4], 64)
-		miner := cmds[5]
-		data := cmds[6]
-		cli.send(from, to, amount, miner, data)
+		amount, err := ParseAmount(cmds[4])
+		if err != nil || amount == 0 {
+			fmt.Println("转账金额无效")
+			return
+		}
+		//手续费（可选，默认为0）
+		var fee Amount
+		if feeStr, ok := options["--fee"]; ok {
+			fee, err = ParseAmount(feeStr)
+			if err != nil {
+				fmt.Println("手续费无效")
+				return
+			}
+		}
+		selector, err := NewCoinSelector(options["--strategy"])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		//锁定条件（可选，默认不锁定）
+		lock, err := parseTxLock(options)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		cli.send(from, to, amount, fee, selector, lock)
+
+	case "sendmany":
+		fmt.Println("批量转账")
+		if len(cmds) < 4 {
+			fmt.Println("转账参数错误")
+			return
+		}
+		options, err := parseOptions(cmds[4:], "--fee", "--strategy")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		from := cmds[2]
+		payments, err := parsePayments(cmds[3])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		var fee Amount
+		if feeStr, ok := options["--fee"]; ok {
+			fee, err = ParseAmount(feeStr)
+			if err != nil {
+				fmt.Println("手续费无效")
+				return
+			}
+		}
+		selector, err := NewCoinSelector(options["--strategy"])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		cli.sendMany(from, payments, fee, selector)
+
+	case "sendfromwallet":
+		fmt.Println("钱包转账")
+		if len(cmds) < 4 {
+			fmt.Println("转账参数错误")
+			return
+		}
+		options, err := parseOptions(cmds[4:], "--fee", "--change", "--strategy")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		to := cmds[2]
+		amount, err := ParseAmount(cmds[3])
+		if err != nil || amount == 0 {
+			fmt.Println("转账金额无效")
+			return
+		}
+		var fee Amount
+		if feeStr, ok := options["--fee"]; ok {
+			fee, err = ParseAmount(feeStr)
+			if err != nil {
+				fmt.Println("手续费无效")
+				return
+			}
+		}
+		selector, err := NewCoinSelector(options["--strategy"])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		cli.sendFromWallet(to, amount, fee, options["--change"], selector)
+
+	case "mine":
+		fmt.Println("挖矿")
+		if len(cmds) != 3 && len(cmds) != 4 {
+			fmt.Println("请输入矿工地址")
+			return
+		}
+		miner := cmds[2]
+		data := ""
+		if len(cmds) == 4 {
+			data = cmds[3]
+		}
+		cli.mine(miner, data)
+
+	case "mempool":
+		fmt.Println("内存池")
+		cli.printMempool()
 	case "createwallet":
 		fmt.Println("创建钱包")
-		cli.createWallet()
+		compressed := true
+		var account uint64
+		switch {
+		case len(cmds) == 3 && cmds[2] == "--uncompressed":
+			compressed = false
+		case len(cmds) == 4 && cmds[2] == "--account":
+			var err error
+			account, err = strconv.ParseUint(cmds[3], 10, 31)
+			if err != nil {
+				fmt.Println("账户编号无效")
+				return
+			}
+		case len(cmds) != 2:
+			fmt.Println("输入参数错误")
+			return
+		}
+		cli.createWallet(compressed, uint32(account))
+
+	case "restorewallet":
+		fmt.Println("恢复HD钱包")
+		if len(cmds) < 3 {
+			fmt.Println("请输入助记词")
+			return
+		}
+		//助记词可以作为一个参数（加引号）或多个参数传入
+		cli.restoreWallet(strings.Join(cmds[2:], " "))
 
 	case "listaddress":
 		fmt.Println("所有钱包地址")
 		cli.listAddresses()
 
+	case "dumpprivkey":
+		fmt.Println("导出私钥")
+		if len(cmds) != 3 {
+			fmt.Println("请输入地址")
+			return
+		}
+		cli.dumpPrivKey(cmds[2])
+
+	case "importprivkey":
+		fmt.Println("导入私钥")
+		if len(cmds) != 3 && len(cmds) != 4 {
+			fmt.Println("导入参数错误")
+			return
+		}
+		label := ""
+		if len(cmds) == 4 {
+			label = cmds[3]
+		}
+		cli.importPrivKey(cmds[2], label)
+
+	case "importaddress":
+		fmt.Println("导入只读地址")
+		if len(cmds) != 3 && len(cmds) != 4 {
+			fmt.Println("导入参数错误")
+			return
+		}
+		label := ""
+		if len(cmds) == 4 {
+			label = cmds[3]
+		}
+		cli.importAddress(cmds[2], label)
+
+	case "getwalletbalance":
+		fmt.Println("查询钱包余额")
+		cli.getWalletBalance()
+
+	case "listtransactions":
+		fmt.Println("钱包收支记录")
+		cli.listTransactions()
+
+	case "encryptwallet":
+		fmt.Println("加密钱包")
+		cli.encryptWallet()
+
+	case "walletpassphrase":
+		fmt.Println("解锁钱包")
+		if len(cmds) != 3 {
+			fmt.Println("请输入解锁时间（秒）")
+			return
+		}
+		timeout, err := strconv.ParseUint(cmds[2], 10, 32)
+		if err != nil || timeout == 0 {
+			fmt.Println("解锁时间无效")
+			return
+		}
+		cli.walletPassphrase(time.Duration(timeout) * time.Second)
+
+	case "walletlock":
+		fmt.Println("锁定钱包")
+		cli.walletLock()
+
+	case "getpubkey":
+		fmt.Println("查询公钥")
+		if len(cmds) != 3 {
+			fmt.Println("请输入地址")
+			return
+		}
+		cli.getPubKey(cmds[2])
+
+	case "createmultisig":
+		fmt.Println("创建多重签名地址")
+		if len(cmds) != 4 {
+			fmt.Println("输入参数错误")
+			return
+		}
+		required, err := strconv.Atoi(cmds[2])
+		if err != nil {
+			fmt.Println("签名个数无效")
+			return
+		}
+		cli.createMultisig(required, strings.Split(cmds[3], ","))
+
+	case "createmultisigtx":
+		fmt.Println("创建多重签名交易")
+		if len(cmds) < 6 {
+			fmt.Println("转账参数错误")
+			return
+		}
+		options, err := parseOptions(cmds[6:], "--fee", "--strategy")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		amount, err := ParseAmount(cmds[4])
+		if err != nil || amount == 0 {
+			fmt.Println("转账金额无效")
+			return
+		}
+		var fee Amount
+		if feeStr, ok := options["--fee"]; ok {
+			fee, err = ParseAmount(feeStr)
+			if err != nil {
+				fmt.Println("手续费无效")
+				return
+			}
+		}
+		selector, err := NewCoinSelector(options["--strategy"])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		cli.createMultisigTransaction(cmds[2], cmds[3], amount, fee, selector, cmds[5])
+
+	case "signmultisigtx":
+		fmt.Println("多重签名交易签名")
+		if len(cmds) != 3 {
+			fmt.Println("请输入交易文件")
+			return
+		}
+		cli.signMultisigTransaction(cmds[2])
+
+	case "sendmultisigtx":
+		fmt.Println("发送多重签名交易")
+		if len(cmds) != 3 {
+			fmt.Println("请输入交易文件")
+			return
+		}
+		cli.sendMultisigTransaction(cmds[2])
+
+	case "notarize":
+		fmt.Println("文件存证")
+		if len(cmds) < 4 {
+			fmt.Println("存证参数错误")
+			return
+		}
+		options, err := parseOptions(cmds[4:], "--fee", "--strategy")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		var fee Amount
+		if feeStr, ok := options["--fee"]; ok {
+			fee, err = ParseAmount(feeStr)
+			if err != nil {
+				fmt.Println("手续费无效")
+				return
+			}
+		}
+		selector, err := NewCoinSelector(options["--strategy"])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		cli.notarize(cmds[2], cmds[3], fee, selector)
+
+	case "verifynotary":
+		fmt.Println("查询文件存证")
+		if len(cmds) != 3 {
+			fmt.Println("请输入文件")
+			return
+		}
+		cli.verifyNotary(cmds[2])
+
 	case "printtx":
 		fmt.Println("打印区块的所有交易")
 		cli.printTX()
+
+	case "reindexutxo":
+		fmt.Println("重建UTXO集")
+		cli.reindexUTXO()
+
+	case "reindextx":
+		fmt.Println("重建交易索引")
+		cli.reindexTransactions()
+
+	case "gettx":
+		fmt.Println("查询交易")
+		if len(cmds) != 3 {
+			fmt.Println("请输入交易ID")
+			return
+		}
+		txid := cmds[2]
+		cli.getTransaction(txid)
+
+	case "getblock":
+		fmt.Println("查询区块")
+		if len(cmds) != 3 {
+			fmt.Println("请输入区块高度或哈希")
+			return
+		}
+		cli.getBlock(cmds[2])
+
+	case "getblockhash":
+		fmt.Println("查询区块哈希")
+		if len(cmds) != 3 {
+			fmt.Println("请输入区块高度")
+			return
+		}
+		cli.getBlockHash(cmds[2])
+
+	case "getblockcount":
+		fmt.Println("查询区块高度")
+		cli.getBlockCount()
+
+	case "reindexheight":
+		fmt.Println("重建区块高度索引")
+		cli.reindexHeights()
+
+	case "getmerkleproof":
+		fmt.Println("查询梅克尔证明")
+		if len(cmds) != 3 {
+			fmt.Println("请输入交易ID")
+			return
+		}
+		cli.getMerkleProof(cmds[2])
+
+	case "supply":
+		fmt.Println("货币发行情况")
+		cli.supply()
+
+	case "migratedb":
+		fmt.Println("转换数据库格式")
+		cli.migrateDB()
 	default:
 		fmt.Println("输入参数错误")
 	}
 }
+
+//parseOptions 解析命令末尾的可选参数（--name value），只接受names中列出的参数
+func parseOptions(args []string, names ...string) (map[string]string, error) {
+	options := make(map[string]string)
+	for i := 0; i < len(args); i += 2 {
+		name := args[i]
+		known := false
+		for _, n := range names {
+			if n == name {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, errors.New("未知的参数: " + name)
+		}
+		if i+1 >= len(args) {
+			return nil, errors.New("参数缺少值: " + name)
+		}
+		options[name] = args[i+1]
+	}
+	return options, nil
+}
+
+//parseTxLock 解析--locktime和--sequence参数
+func parseTxLock(options map[string]string) (TxLock, error) {
+	var lock TxLock
+	if value, ok := options["--locktime"]; ok {
+		lockTime, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return lock, errors.New("锁定时间无效: " + value)
+		}
+		lock.LockTime = uint32(lockTime)
+	}
+	if value, ok := options["--sequence"]; ok {
+		sequence, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || sequence == 0 {
+			return lock, errors.New("input序号无效: " + value)
+		}
+		lock.Sequence = uint32(sequence)
+	}
+	return lock, nil
+}
+
+//parsePayments 解析收款人列表：addr1:amount1,addr2:amount2,...
+func parsePayments(arg string) ([]Payment, error) {
+	var payments []Payment
+	for _, item := range strings.Split(arg, ",") {
+		parts := strings.Split(item, ":")
+		if len(parts) != 2 {
+			return nil, errors.New("收款人格式错误: " + item)
+		}
+		amount, err := ParseAmount(parts[1])
+		if err != nil || amount == 0 {
+			return nil, errors.New("转账金额无效: " + item)
+		}
+		payments = append(payments, Payment{Address: parts[0], Amount: amount})
+	}
+	return payments, nil
+}
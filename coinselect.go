@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+/*
+	选币策略：
+		转账时需要从可以使用的utxo中选出一部分作为input，总金额不小于转账金额+手续费。
+		不同的选择方式影响找零和零钱（dust）的多少：
+			largest  - 从大到小选择，input最少
+			smallest - 从小到大选择，优先花掉零钱
+			bnb      - 分支定界搜索总金额恰好等于目标的组合，不产生找零，找不到时使用后备策略
+			random   - 随机顺序选择
+		选币策略只依赖传入的utxo集合，不访问数据库。
+*/
+
+//选币错误
+var (
+	ErrInsufficientFunds = errors.New("金额不足")
+	ErrNoExactMatch      = errors.New("没有找到总金额恰好等于目标的utxo组合")
+	ErrUnknownStrategy   = errors.New("未知的选币策略")
+)
+
+//分支定界搜索的最大尝试次数
+const maxBnBTries = 100000
+
+//CoinSelector 选币策略：从utxos中选出总金额不小于target的utxo，返回选中的utxo及其总金额
+type CoinSelector interface {
+	Select(utxos []UTXOInfo, target Amount) ([]UTXOInfo, Amount, error)
+}
+
+//LargestFirstSelector 从大到小选择
+type LargestFirstSelector struct{}
+
+//Select 实现CoinSelector
+func (LargestFirstSelector) Select(utxos []UTXOInfo, target Amount) ([]UTXOInfo, Amount, error) {
+	sorted := sortUTXOByValue(utxos, true)
+	return accumulateUTXO(sorted, target)
+}
+
+//SmallestFirstSelector 从小到大选择
+type SmallestFirstSelector struct{}
+
+//Select 实现CoinSelector
+func (SmallestFirstSelector) Select(utxos []UTXOInfo, target Amount) ([]UTXOInfo, Amount, error) {
+	sorted := sortUTXOByValue(utxos, false)
+	return accumulateUTXO(sorted, target)
+}
+
+//RandomSelector 随机顺序选择
+type RandomSelector struct {
+	Rand *rand.Rand //随机数生成器，为nil时使用当前时间作为种子
+}
+
+//Select 实现CoinSelector
+func (s RandomSelector) Select(utxos []UTXOInfo, target Amount) ([]UTXOInfo, Amount, error) {
+	r := s.Rand
+	if r == nil {
+		r = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	shuffled := append([]UTXOInfo{}, utxos...)
+	r.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return accumulateUTXO(shuffled, target)
+}
+
+//BranchAndBoundSelector 分支定界：搜索总金额恰好等于target的组合（不需要找零）
+type BranchAndBoundSelector struct {
+	Fallback CoinSelector //找不到时使用的后备策略，为nil时返回ErrNoExactMatch
+}
+
+//Select 实现CoinSelector
+func (s BranchAndBoundSelector) Select(utxos []UTXOInfo, target Amount) ([]UTXOInfo, Amount, error) {
+	//从大到小搜索，尽早超过目标值以便剪枝
+	sorted := sortUTXOByValue(utxos, true)
+
+	//remaining[i]为第i个及之后所有utxo的总金额
+	remaining := make([]Amount, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].Value
+	}
+	if remaining[0] < target {
+		return nil, 0, ErrInsufficientFunds
+	}
+
+	var found []int //选中的utxo下标
+	tries := 0
+	//依次决定每个utxo选或不选，返回true表示停止搜索
+	var search func(i int, total Amount, chosen []int) bool
+	search = func(i int, total Amount, chosen []int) bool {
+		tries++
+		if tries > maxBnBTries {
+			return true
+		}
+		if total == target {
+			found = append([]int{}, chosen...)
+			return true
+		}
+		//超过目标值，或剩余的utxo全部选上也不够
+		if total > target || i == len(sorted) || total+remaining[i] < target {
+			return false
+		}
+		if search(i+1, total+sorted[i].Value, append(chosen, i)) {
+			return true
+		}
+		return search(i+1, total, chosen)
+	}
+	search(0, 0, nil)
+
+	if found == nil {
+		if s.Fallback != nil {
+			return s.Fallback.Select(utxos, target)
+		}
+		return nil, 0, ErrNoExactMatch
+	}
+	var selected []UTXOInfo
+	for _, i := range found {
+		selected = append(selected, sorted[i])
+	}
+	return selected, target, nil
+}
+
+//NewCoinSelector 根据名称创建选币策略，名称为空时使用largest
+func NewCoinSelector(name string) (CoinSelector, error) {
+	switch name {
+	case "", "largest":
+		return LargestFirstSelector{}, nil
+	case "smallest":
+		return SmallestFirstSelector{}, nil
+	case "bnb":
+		return BranchAndBoundSelector{Fallback: LargestFirstSelector{}}, nil
+	case "random":
+		return RandomSelector{}, nil
+	default:
+		return nil, ErrUnknownStrategy
+	}
+}
+
+//sortUTXOByValue 按金额排序utxo的副本（desc为true时从大到小），金额相同时按交易ID和索引排序
+func sortUTXOByValue(utxos []UTXOInfo, desc bool) []UTXOInfo {
+	sorted := append([]UTXOInfo{}, utxos...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Value != sorted[j].Value {
+			return (sorted[i].Value > sorted[j].Value) == desc
+		}
+		return string(utxoKey(sorted[i].TXID, sorted[i].Index)) < string(utxoKey(sorted[j].TXID, sorted[j].Index))
+	})
+	return sorted
+}
+
+//accumulateUTXO 按顺序累加utxo，直到总金额不小于target
+func accumulateUTXO(utxos []UTXOInfo, target Amount) ([]UTXOInfo, Amount, error) {
+	var selected []UTXOInfo
+	var total Amount
+	for _, utxo := range utxos {
+		if total >= target {
+			break
+		}
+		selected = append(selected, utxo)
+		total += utxo.Value //UTXO集中的金额均已校验，不会溢出
+	}
+	if total < target {
+		return nil, 0, ErrInsufficientFunds
+	}
+	return selected, total, nil
+}
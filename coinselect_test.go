@@ -0,0 +1,160 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+//newTestUTXOs 创建金额依次为values的utxo集合，交易ID各不相同
+func newTestUTXOs(values ...Amount) []UTXOInfo {
+	var utxos []UTXOInfo
+	for i, value := range values {
+		utxos = append(utxos, UTXOInfo{
+			TXID:     []byte{byte(i >> 8), byte(i)},
+			Index:    int64(i),
+			TXOutput: TXOutput{Value: value},
+		})
+	}
+	return utxos
+}
+
+//repeatValue 创建n个相同的金额
+func repeatValue(value Amount, n int) []Amount {
+	values := make([]Amount, n)
+	for i := range values {
+		values[i] = value
+	}
+	return values
+}
+
+//selectorCase 选币策略的测试用例
+type selectorCase struct {
+	name   string
+	values []Amount //utxo集合的金额
+	target Amount
+	want   []Amount //选中的utxo的金额（按选中的顺序）
+	err    error
+}
+
+//checkSelector 依次执行测试用例，检查选中的utxo、错误和返回的总金额
+func checkSelector(t *testing.T, selector CoinSelector, cases []selectorCase) {
+	t.Helper()
+	for _, c := range cases {
+		selected, total, err := selector.Select(newTestUTXOs(c.values...), c.target)
+		if err != c.err {
+			t.Errorf("%s: 错误为%v，期望%v", c.name, err, c.err)
+			continue
+		}
+		if err != nil {
+			if selected != nil || total != 0 {
+				t.Errorf("%s: 出错时返回了%d个utxo，总金额%d", c.name, len(selected), total)
+			}
+			continue
+		}
+		var got []Amount
+		var sum Amount
+		for _, utxo := range selected {
+			got = append(got, utxo.Value)
+			sum += utxo.Value
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: 选中%v，期望%v", c.name, got, c.want)
+		}
+		if total != sum {
+			t.Errorf("%s: 返回的总金额%d不等于选中金额之和%d", c.name, total, sum)
+		}
+		if total < c.target {
+			t.Errorf("%s: 总金额%d小于目标%d", c.name, total, c.target)
+		}
+	}
+}
+
+//TestLargestFirstSelector 从大到小选择
+func TestLargestFirstSelector(t *testing.T) {
+	checkSelector(t, LargestFirstSelector{}, []selectorCase{
+		{"一个足够", []Amount{1, 5, 3}, 4, []Amount{5}, nil},
+		{"多个", []Amount{1, 5, 3}, 7, []Amount{5, 3}, nil},
+		{"全部", []Amount{1, 5, 3}, 9, []Amount{5, 3, 1}, nil},
+		{"不足", []Amount{1, 5, 3}, 10, nil, ErrInsufficientFunds},
+		{"空集合", nil, 1, nil, ErrInsufficientFunds},
+	})
+}
+
+//TestSmallestFirstSelector 从小到大选择
+func TestSmallestFirstSelector(t *testing.T) {
+	checkSelector(t, SmallestFirstSelector{}, []selectorCase{
+		{"一个足够", []Amount{4, 1, 3}, 1, []Amount{1}, nil},
+		{"多个", []Amount{4, 1, 3}, 4, []Amount{1, 3}, nil},
+		{"全部", []Amount{4, 1, 3}, 8, []Amount{1, 3, 4}, nil},
+		{"不足", []Amount{4, 1, 3}, 9, nil, ErrInsufficientFunds},
+	})
+}
+
+//TestBranchAndBoundSelector 恰好组合、没有组合时的后备策略
+func TestBranchAndBoundSelector(t *testing.T) {
+	checkSelector(t, BranchAndBoundSelector{}, []selectorCase{
+		{"恰好一个", []Amount{10, 7, 3}, 7, []Amount{7}, nil},
+		{"恰好组合", []Amount{10, 7, 5, 3}, 8, []Amount{5, 3}, nil},
+		{"跳过大额", []Amount{10, 6, 4, 1}, 11, []Amount{10, 1}, nil},
+		{"没有组合", []Amount{10, 7, 3}, 9, nil, ErrNoExactMatch},
+		{"不足", []Amount{10, 7, 3}, 21, nil, ErrInsufficientFunds},
+	})
+	//找不到恰好的组合时使用后备策略，金额不足时不使用后备策略
+	checkSelector(t, BranchAndBoundSelector{Fallback: SmallestFirstSelector{}}, []selectorCase{
+		{"恰好组合", []Amount{10, 7, 5, 3}, 8, []Amount{5, 3}, nil},
+		{"后备策略", []Amount{10, 7, 3}, 9, []Amount{3, 7}, nil},
+		{"不足", []Amount{10, 7, 3}, 21, nil, ErrInsufficientFunds},
+	})
+}
+
+//TestBranchAndBoundMaxTries 超过最大尝试次数时停止搜索
+func TestBranchAndBoundMaxTries(t *testing.T) {
+	//20个2可以恰好组成40，但先选中的5使和为奇数，
+	//包含5的分支超过maxBnBTries次尝试后停止搜索，找不到恰好的组合
+	values := append([]Amount{5}, repeatValue(2, 40)...)
+	checkSelector(t, BranchAndBoundSelector{}, []selectorCase{
+		{"没有5", repeatValue(2, 40), 40, repeatValue(2, 20), nil},
+		{"超过尝试次数", values, 40, nil, ErrNoExactMatch},
+	})
+	checkSelector(t, BranchAndBoundSelector{Fallback: LargestFirstSelector{}}, []selectorCase{
+		{"超过尝试次数使用后备策略", values, 40, append([]Amount{5}, repeatValue(2, 18)...), nil},
+	})
+}
+
+//TestRandomSelector 固定种子的随机选择
+func TestRandomSelector(t *testing.T) {
+	values := []Amount{1, 2, 3, 4, 5, 6, 7, 8}
+	//相同的种子选择结果相同
+	first, _, err := RandomSelector{Rand: rand.New(rand.NewSource(1))}.Select(newTestUTXOs(values...), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := RandomSelector{Rand: rand.New(rand.NewSource(1))}.Select(newTestUTXOs(values...), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("相同种子的选择结果不同: %v %v", first, second)
+	}
+
+	var want []Amount
+	for _, utxo := range first {
+		want = append(want, utxo.Value)
+	}
+	checkSelector(t, RandomSelector{Rand: rand.New(rand.NewSource(1))}, []selectorCase{
+		{"固定种子", values, 10, want, nil},
+	})
+	checkSelector(t, RandomSelector{Rand: rand.New(rand.NewSource(2))}, []selectorCase{
+		{"不足", values, 37, nil, ErrInsufficientFunds},
+	})
+
+	//目标为全部金额时选中所有utxo（顺序随机）
+	selected, total, err := RandomSelector{Rand: rand.New(rand.NewSource(2))}.Select(newTestUTXOs(values...), 36)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selected) != len(values) || total != 36 {
+		t.Errorf("选中%d个utxo，总金额%d，期望%d个，总金额36", len(selected), total, len(values))
+	}
+}
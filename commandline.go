@@ -1,6 +1,15 @@
 package main
 
-import "fmt"
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
 
 /*
 	命令行方法
@@ -34,18 +43,23 @@ func (cli *CLI) getBalance(address string) {
 		fmt.Println(err)
 		return
 	}
-	//获得地址对应的公钥哈希
-	pubKeyHash := GetPubKeyHashFromAddress(address)
+	defer bc.db.Close()
+	//获得地址对应的锁定脚本
+	script := AddressToScript(address)
 
 	//获取地址的utxo详情
-	utxoInfos := bc.FindMyUTXO(pubKeyHash)
+	utxoInfos := bc.FindMyUTXO(script)
 	//遍历累加金额
-	total := 0.0
+	var total Amount
 	for _, utxo := range utxoInfos {
-		total += utxo.TXOutput.Value
+		total, err = AddAmount(total, utxo.TXOutput.Value)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
 	}
 
-	fmt.Printf("%s的金额为: %f\n", address, total)
+	fmt.Printf("%s的金额为: %s\n", address, total)
 }
 
 //打印区块链
@@ -62,20 +76,8 @@ func (cli *CLI) printBlockChain() {
 	for {
 		//使用迭代器Next方法获取区块并移动游标
 		block := it.Next()
-		//打印区块链
-		fmt.Println("===============================")
-		fmt.Printf("Version: %d\n", block.Version)
-		fmt.Printf("PrevHash: %x\n", block.PrevHash)
-		fmt.Printf("MerkleRoot: %x\n", block.MerkleRoot)
-		fmt.Printf("TimeStamp: %d\n", block.TimeStamp)
-		fmt.Printf("Bits: %d\n", block.Bits)
-		fmt.Printf("Nonce: %d\n", block.Nonce)
-		fmt.Printf("Hash: %x\n", block.Hash)
-		fmt.Printf("Data: %s\n", block.Transactions[0].TXInputs[0].ScriptSign)
-
-		//校验区块（工作量验证）
-		pow := NewProofOfWork(block)
-		fmt.Printf("IsValid: %v\n", pow.IsValid())
+		//打印区块
+		printBlock(block)
 
 		//如果区块前哈希为空则退出循环
 		if block.PrevHash == nil {
@@ -84,8 +86,26 @@ func (cli *CLI) printBlockChain() {
 	}
 }
 
-//转账：每次转账时便添加一个区块
-func (cli *CLI) send(from string, to string, amount float64, miner string, data string) {
+//打印区块信息
+func printBlock(block *Block) {
+	fmt.Println("===============================")
+	fmt.Printf("Version: %d\n", block.Version)
+	fmt.Printf("Height: %d\n", block.Height)
+	fmt.Printf("PrevHash: %x\n", block.PrevHash)
+	fmt.Printf("MerkleRoot: %x\n", block.MerkleRoot)
+	fmt.Printf("TimeStamp: %d\n", block.TimeStamp)
+	fmt.Printf("Bits: %08x\n", block.Bits)
+	fmt.Printf("Nonce: %d\n", block.Nonce)
+	fmt.Printf("Hash: %x\n", block.Hash)
+	fmt.Printf("Data: %s\n", block.Transactions[0].coinbaseData())
+
+	//校验区块（工作量验证）
+	pow := NewProofOfWork(block)
+	fmt.Printf("IsValid: %v\n", pow.IsValid())
+}
+
+//转账：创建交易并放入内存池，由mine命令打包到区块中
+func (cli *CLI) send(from string, to string, amount Amount, fee Amount, selector CoinSelector, lock TxLock) {
 	if !IsValidAddress(from) {
 		fmt.Println("传入from地址无效")
 		return
@@ -94,10 +114,48 @@ func (cli *CLI) send(from string, to string, amount float64, miner string, data
 		fmt.Println("传入to地址无效")
 		return
 	}
-	if !IsValidAddress(miner) {
-		fmt.Println("传入miner地址无效")
+
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	//创建普通交易
+	tx := NewTransaction(from, to, amount, fee, selector, lock, bc)
+	if tx == nil {
+		fmt.Println("未找到有效交易")
+		return
+	}
+
+	//放入内存池
+	mp, err := bc.LoadMempool()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	err = bc.AcceptToMempool(mp, tx)
+	if err != nil {
+		fmt.Println("转账失败:", err)
+		return
+	}
+	fmt.Printf("转账成功，交易已放入内存池: %x\n", tx.TXID)
+}
+
+//批量转账：一笔交易向多个收款人转账，交易放入内存池
+func (cli *CLI) sendMany(from string, payments []Payment, fee Amount, selector CoinSelector) {
+	if !IsValidAddress(from) {
+		fmt.Println("传入from地址无效")
 		return
 	}
+	for _, payment := range payments {
+		if !IsValidAddress(payment.Address) {
+			fmt.Println("传入收款人地址无效:", payment.Address)
+			return
+		}
+	}
 
 	//获取一个区块链实例
 	bc, err := GetBlockChainInstance()
@@ -107,37 +165,124 @@ func (cli *CLI) send(from string, to string, amount float64, miner string, data
 	}
 	defer bc.db.Close()
 
-	//创建挖矿交易
-	coinbaseTX := NewCoinbaseTX(miner, data)
+	//创建多个output的交易
+	tx := NewTransactionMany(from, payments, fee, selector, TxLock{}, bc)
+	if tx == nil {
+		fmt.Println("未找到有效交易")
+		return
+	}
 
-	//创建交易集合，添加有效交易
-	txs := []*Transaction{coinbaseTX}
+	//放入内存池
+	mp, err := bc.LoadMempool()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	err = bc.AcceptToMempool(mp, tx)
+	if err != nil {
+		fmt.Println("转账失败:", err)
+		return
+	}
+	fmt.Printf("转账成功，共%d个收款人，交易已放入内存池: %x\n", len(payments), tx.TXID)
+}
 
-	//创建普通交易
-	tx := NewTransaction(from, to, amount, bc)
-	if tx != nil { //找到有效交易
-		txs = append(txs, tx)
-	} else {
+//钱包转账：从钱包中的任意地址选择utxo付款，交易放入内存池
+func (cli *CLI) sendFromWallet(to string, amount Amount, fee Amount, change string, selector CoinSelector) {
+	if !IsValidAddress(to) {
+		fmt.Println("传入to地址无效")
+		return
+	}
+	if change != "" && !IsValidAddress(change) {
+		fmt.Println("传入找零地址无效")
+		return
+	}
+
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	//创建从多个地址付款的交易
+	tx := NewWalletTransaction([]Payment{{Address: to, Amount: amount}}, fee, change, selector, bc)
+	if tx == nil {
 		fmt.Println("未找到有效交易")
+		return
+	}
+
+	//放入内存池
+	mp, err := bc.LoadMempool()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	err = bc.AcceptToMempool(mp, tx)
+	if err != nil {
+		fmt.Println("转账失败:", err)
+		return
+	}
+	fmt.Printf("转账成功，共使用%d个input，交易已放入内存池: %x\n", len(tx.TXInputs), tx.TXID)
+}
+
+//挖矿：从内存池选择交易打包成新区块
+func (cli *CLI) mine(miner string, data string) {
+	if !IsValidAddress(miner) {
+		fmt.Println("传入miner地址无效")
+		return
+	}
+
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	mp, err := bc.LoadMempool()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	block, err := bc.MineBlock(mp, miner, data)
+	if err != nil {
+		fmt.Println("挖矿失败:", err)
+		return
+	}
+	fmt.Printf("挖矿成功，区块高度: %d，哈希: %x，交易数: %d\n", block.Height, block.Hash, len(block.Transactions))
+}
+
+//打印内存池中的交易
+func (cli *CLI) printMempool() {
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
+	defer bc.db.Close()
 
-	//添加区块
-	err = bc.AddBlock(txs)
+	mp, err := bc.LoadMempool()
 	if err != nil {
-		fmt.Println("转账失败")
+		fmt.Println(err)
 		return
 	}
-	fmt.Println("转账成功")
+	fmt.Printf("内存池交易数: %d\n", mp.Count())
+	for _, entry := range mp.Entries() {
+		fmt.Printf("%x Fee: %s Size: %d FeeRate: %s/kB\n", entry.Tx.TXID, entry.Fee, entry.Size, entry.FeeRate())
+	}
 }
 
-//创建钱包
-func (cli *CLI) createWallet() {
+//创建钱包（默认从HD种子派生account账户的地址，compressed为false时创建随机私钥，公钥使用未压缩格式）
+func (cli *CLI) createWallet(compressed bool, account uint32) {
 	wm := NewWalletManager()
 	if wm == nil {
 		fmt.Println("打开钱包失败")
 		return
 	}
-	address := wm.createWallet()
+	address := wm.createWallet(compressed, account)
 	if len(address) == 0 {
 		fmt.Println("创建钱包失败")
 		return
@@ -154,13 +299,33 @@ func (cli *CLI) listAddresses() {
 	}
 	addresses := wm.listAddresses()
 	for _, address := range addresses {
-		fmt.Println(address)
+		w := wm.Wallets[address]
+		switch {
+		case w.HDPath != "":
+			fmt.Println(address, w.HDPath)
+		case w.Label != "":
+			fmt.Println(address, w.Label)
+		default:
+			fmt.Println(address)
+		}
+	}
+	for _, address := range wm.listWatchOnly() {
+		if label := wm.WatchOnly[address].Label; label != "" {
+			fmt.Println(address, "只读", label)
+		} else {
+			fmt.Println(address, "只读")
+		}
 	}
 }
 
-//打印区块的所有交易
-func (cli *CLI) printTX() {
-	//获取一个区块链实例
+//由助记词恢复HD钱包：遍历账本找回使用过的地址并输出余额
+func (cli *CLI) restoreWallet(mnemonic string) {
+	wm := NewWalletManager()
+	if wm == nil {
+		fmt.Println("打开钱包失败")
+		return
+	}
+
 	bc, err := GetBlockChainInstance()
 	if err != nil {
 		fmt.Println(err)
@@ -168,18 +333,810 @@ func (cli *CLI) printTX() {
 	}
 	defer bc.db.Close()
 
-	it := bc.NewIterator()
+	used, err := bc.usedPubKeyHashes()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	addresses, err := wm.restoreHD(mnemonic, used)
+	if err != nil {
+		fmt.Println("恢复钱包失败:", err)
+		return
+	}
 
-	for {
-		block := it.Next()
-		fmt.Println("==============================")
+	var total Amount
+	for _, address := range addresses {
+		var balance Amount
+		for _, utxoInfo := range bc.FindMyUTXO(AddressToScript(address)) {
+			balance, err = AddAmount(balance, utxoInfo.Value)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+		total, err = AddAmount(total, balance)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("%s %s 余额: %s\n", address, wm.Wallets[address].HDPath, balance)
+	}
+	fmt.Printf("恢复钱包成功，共%d个地址，总余额: %s\n", len(addresses), total)
+}
 
-		for _, tx := range block.Transactions {
-			//直接打印交易：在Transaction中实现String方法
-			fmt.Println(tx)
+//导出地址的私钥
+func (cli *CLI) dumpPrivKey(address string) {
+	wm := NewWalletManager()
+	if wm == nil {
+		fmt.Println("打开钱包失败")
+		return
+	}
+	wif, err := wm.dumpPrivateKey(address)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(wif)
+}
+
+//导入私钥并遍历账本输出该地址的收支记录
+func (cli *CLI) importPrivKey(wif string, label string) {
+	wm := NewWalletManager()
+	if wm == nil {
+		fmt.Println("打开钱包失败")
+		return
+	}
+	address, err := wm.importPrivateKey(wif, label)
+	if err != nil {
+		fmt.Println("导入私钥失败:", err)
+		return
+	}
+	fmt.Println("导入私钥成功:", address)
+
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+	printAddressHistory(bc, address)
+}
+
+//导入只读地址或公钥并遍历账本输出该地址的收支记录
+func (cli *CLI) importAddress(addressOrPubKey string, label string) {
+	wm := NewWalletManager()
+	if wm == nil {
+		fmt.Println("打开钱包失败")
+		return
+	}
+	address, err := wm.importWatchOnly(addressOrPubKey, label)
+	if err != nil {
+		fmt.Println("导入只读地址失败:", err)
+		return
+	}
+	fmt.Println("导入只读地址成功:", address)
+
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+	printAddressHistory(bc, address)
+}
+
+//输出钱包中每个地址的余额，可用余额、多重签名地址和只读地址的余额分开统计
+func (cli *CLI) getWalletBalance() {
+	wm := NewWalletManager()
+	if wm == nil {
+		fmt.Println("打开钱包失败")
+		return
+	}
+
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	fmt.Println("钱包地址:")
+	spendable, ok := printBalances(bc, wm.listAddresses())
+	if !ok {
+		return
+	}
+	fmt.Println("多重签名地址:")
+	multisig, ok := printBalances(bc, wm.listMultisig())
+	if !ok {
+		return
+	}
+	fmt.Println("只读地址:")
+	watching, ok := printBalances(bc, wm.listWatchOnly())
+	if !ok {
+		return
+	}
+	fmt.Printf("可用余额: %s，多重签名余额: %s，只读余额: %s\n", spendable, multisig, watching)
+}
+
+//printBalances 输出每个地址的余额，返回总余额
+func printBalances(bc *BlockChain, addresses []string) (Amount, bool) {
+	var total Amount
+	for _, address := range addresses {
+		var balance Amount
+		var err error
+		for _, utxoInfo := range bc.FindMyUTXO(AddressToScript(address)) {
+			balance, err = AddAmount(balance, utxoInfo.Value)
+			if err != nil {
+				fmt.Println(err)
+				return 0, false
+			}
 		}
-		if len(block.PrevHash) == 0 {
-			break
+		total, err = AddAmount(total, balance)
+		if err != nil {
+			fmt.Println(err)
+			return 0, false
+		}
+		fmt.Printf("%s 余额: %s\n", address, balance)
+	}
+	return total, true
+}
+
+//遍历账本输出钱包的收支记录，钱包地址、多重签名地址和只读地址分开输出
+func (cli *CLI) listTransactions() {
+	wm := NewWalletManager()
+	if wm == nil {
+		fmt.Println("打开钱包失败")
+		return
+	}
+
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	groups := []struct {
+		name      string
+		addresses []string
+	}{
+		{"钱包地址", wm.listAddresses()},
+		{"多重签名地址", wm.listMultisig()},
+		{"只读地址", wm.listWatchOnly()},
+	}
+	for _, group := range groups {
+		var scripts [][]byte
+		for _, address := range group.addresses {
+			scripts = append(scripts, AddressToScript(address))
+		}
+		history, err := bc.ScriptsHistory(scripts)
+		if err != nil {
+			fmt.Println("遍历账本失败:", err)
+			return
+		}
+		fmt.Printf("%s的收支记录:\n", group.name)
+		balance, err := printHistory(history)
+		if err != nil {
+			fmt.Println(err)
+			return
 		}
+		fmt.Printf("%s共%d笔交易，余额: %s\n", group.name, len(history), balance)
+	}
+}
+
+//printAddressHistory 遍历账本输出地址的收支记录和余额
+func printAddressHistory(bc *BlockChain, address string) {
+	history, err := bc.AddressHistory(AddressToScript(address))
+	if err != nil {
+		fmt.Println("遍历账本失败:", err)
+		return
+	}
+	balance, err := printHistory(history)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%s共%d笔交易，余额: %s\n", address, len(history), balance)
+}
+
+//printHistory 输出收支记录，返回余额
+func printHistory(history []HistoryEntry) (Amount, error) {
+	var balance Amount
+	for _, entry := range history {
+		fmt.Printf("高度%d %x 收入: %s 支出: %s\n", entry.Height, entry.TXID, entry.Received, entry.Spent)
+		var err error
+		balance, err = AddAmount(balance, entry.Received)
+		if err == nil {
+			balance, err = SubAmount(balance, entry.Spent)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return balance, nil
+}
+
+//加密钱包：从标准输入读取两次密码
+func (cli *CLI) encryptWallet() {
+	wm := NewWalletManager()
+	if wm == nil {
+		fmt.Println("打开钱包失败")
+		return
+	}
+	if wm.isEncrypted() {
+		fmt.Println(ErrWalletEncrypted)
+		return
+	}
+
+	r := bufio.NewReader(os.Stdin)
+	passphrase, err := readPassphrase(r, "请输入钱包密码: ")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	confirm, err := readPassphrase(r, "请再次输入钱包密码: ")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if !bytes.Equal(passphrase, confirm) {
+		fmt.Println("两次输入的密码不一致")
+		return
+	}
+
+	err = wm.encrypt(passphrase)
+	if err != nil {
+		fmt.Println("加密钱包失败:", err)
+		return
+	}
+	fmt.Println("钱包已加密，请牢记密码，忘记密码将无法使用钱包中的资金")
+}
+
+//解锁钱包：timeout后自动锁定
+func (cli *CLI) walletPassphrase(timeout time.Duration) {
+	wm := NewWalletManager()
+	if wm == nil {
+		fmt.Println("打开钱包失败")
+		return
+	}
+	if !wm.isEncrypted() {
+		fmt.Println(ErrWalletPlaintext)
+		return
+	}
+
+	passphrase, err := readPassphrase(bufio.NewReader(os.Stdin), "请输入钱包密码: ")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	err = wm.walletPassphrase(passphrase, timeout)
+	if err != nil {
+		fmt.Println("解锁钱包失败:", err)
+		return
+	}
+	fmt.Printf("钱包已解锁，%s后自动锁定\n", timeout)
+}
+
+//锁定钱包
+func (cli *CLI) walletLock() {
+	wm := NewWalletManager()
+	if wm == nil {
+		fmt.Println("打开钱包失败")
+		return
+	}
+	if !wm.isEncrypted() {
+		fmt.Println(ErrWalletPlaintext)
+		return
+	}
+	err := wm.walletLock()
+	if err != nil {
+		fmt.Println("锁定钱包失败:", err)
+		return
+	}
+	fmt.Println("钱包已锁定")
+}
+
+//打印区块的所有交易
+func (cli *CLI) printTX() {
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	it := bc.NewIterator()
+
+	for {
+		block := it.Next()
+		fmt.Println("==============================")
+
+		for _, tx := range block.Transactions {
+			//直接打印交易：在Transaction中实现String方法
+			fmt.Println(tx)
+		}
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+}
+
+//重建UTXO集
+func (cli *CLI) reindexUTXO() {
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	count, err := bc.ReindexUTXO()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("重建UTXO集成功，共%d个UTXO\n", count)
+}
+
+//重建交易索引
+func (cli *CLI) reindexTransactions() {
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	count, err := bc.ReindexTransactions()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("重建交易索引成功，共%d笔交易\n", count)
+}
+
+//根据交易ID查询交易
+func (cli *CLI) getTransaction(txidStr string) {
+	txid, err := hex.DecodeString(txidStr)
+	if err != nil {
+		fmt.Println("交易ID无效")
+		return
+	}
+
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	tx, location, err := bc.GetTransaction(txid)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	//区块高度和最新区块高度，确认数 = 最新高度 - 所在高度 + 1
+	height, err := bc.GetBlockHeight(location.BlockHash)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	tipHeight, err := bc.GetBestHeight()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(tx)
+	fmt.Printf("BlockHash: %x\n", location.BlockHash)
+	fmt.Printf("Height: %d\n", height)
+	fmt.Printf("Confirmations: %d\n", tipHeight-height+1)
+}
+
+//根据高度或哈希查询区块
+func (cli *CLI) getBlock(heightOrHash string) {
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	var block *Block
+	//64个字符的16进制字符串视为区块哈希，否则视为区块高度
+	if len(heightOrHash) == 64 {
+		hash, decodeErr := hex.DecodeString(heightOrHash)
+		if decodeErr != nil {
+			fmt.Println("区块哈希无效")
+			return
+		}
+		block, err = bc.GetBlock(hash)
+	} else {
+		height, parseErr := strconv.ParseUint(heightOrHash, 10, 64)
+		if parseErr != nil {
+			fmt.Println("区块高度无效")
+			return
+		}
+		block, err = bc.GetBlockByHeight(height)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	printBlock(block)
+}
+
+//根据高度查询区块哈希
+func (cli *CLI) getBlockHash(heightStr string) {
+	height, err := strconv.ParseUint(heightStr, 10, 64)
+	if err != nil {
+		fmt.Println("区块高度无效")
+		return
+	}
+
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	hash, err := bc.GetBlockHash(height)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%x\n", hash)
+}
+
+//查询最后一个区块的高度
+func (cli *CLI) getBlockCount() {
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	height, err := bc.GetBestHeight()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(height)
+}
+
+//重建区块高度索引
+func (cli *CLI) reindexHeights() {
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	height, err := bc.ReindexHeights()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("重建高度索引成功，最后一个区块高度为%d\n", height)
+}
+
+//根据交易ID输出梅克尔证明（JSON）
+func (cli *CLI) getMerkleProof(txidStr string) {
+	txid, err := hex.DecodeString(txidStr)
+	if err != nil {
+		fmt.Println("交易ID无效")
+		return
+	}
+
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	proof, err := bc.GetMerkleProof(txid)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	data, err := json.MarshalIndent(proof, "", "  ")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+//查询货币发行情况
+func (cli *CLI) supply() {
+	//获取一个区块链实例
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	height, err := bc.GetBestHeight()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	issued, err := GetIssuedSupply(height)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	maxSupply, err := GetMaxSupply()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Printf("Height: %d\n", height)
+	fmt.Printf("Issued: %s\n", issued)
+	fmt.Printf("MaxSupply: %s\n", maxSupply)
+	fmt.Printf("CurrentSubsidy: %s\n", GetBlockSubsidy(height+1))
+	fmt.Printf("NextHalvingHeight: %d\n", GetNextHalvingHeight(height))
+}
+
+//将旧的gob格式数据库转换为当前的二进制格式
+func (cli *CLI) migrateDB() {
+	result, err := MigrateDB(activeNetParams.DBFile)
+	if err != nil {
+		fmt.Println("转换失败:", err)
+		return
+	}
+	fmt.Printf("转换成功，区块: %d，UTXO: %d\n", result.Blocks, result.UTXOs)
+	if result.MempoolDropped > 0 {
+		fmt.Printf("内存池中的%d笔交易已清空，请重新转账\n", result.MempoolDropped)
+	}
+}
+
+//输出钱包地址的公钥（十六进制），创建多重签名地址时使用
+func (cli *CLI) getPubKey(address string) {
+	wm := NewWalletManager()
+	if wm == nil {
+		fmt.Println("打开钱包失败")
+		return
+	}
+	wallet, ok := wm.Wallets[address]
+	if ok {
+		fmt.Printf("%x\n", wallet.PublicKey)
+		return
+	}
+	//导入公钥的只读地址也可以查询公钥
+	watch, ok := wm.WatchOnly[address]
+	if !ok {
+		fmt.Println("钱包中没有该地址")
+		return
+	}
+	if watch.PublicKey == nil {
+		fmt.Println("只读地址没有导入公钥")
+		return
+	}
+	fmt.Printf("%x\n", watch.PublicKey)
+}
+
+//创建M-of-N多重签名地址，赎回脚本保存到钱包
+func (cli *CLI) createMultisig(required int, pubKeyHexes []string) {
+	var pubKeys [][]byte
+	for _, pubKeyHex := range pubKeyHexes {
+		pubKey, err := hex.DecodeString(pubKeyHex)
+		if err != nil {
+			fmt.Println("公钥格式错误:", pubKeyHex)
+			return
+		}
+		//公钥必须能被当前网络的签名方案解析
+		if err := activeNetParams.Scheme.CheckPublicKey(pubKey); err != nil {
+			fmt.Printf("公钥无效: %s（%v）\n", pubKeyHex, err)
+			return
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+	redeemScript, err := NewMultisigScript(required, pubKeys)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	wm := NewWalletManager()
+	if wm == nil {
+		fmt.Println("打开钱包失败")
+		return
+	}
+	address := wm.addMultisig(redeemScript)
+	if len(address) == 0 {
+		fmt.Println("保存多重签名地址失败")
+		return
+	}
+	fmt.Printf("赎回脚本: %s\n", DisasmScript(redeemScript))
+	fmt.Println("创建多重签名地址成功:", address)
+}
+
+//从多重签名地址创建待签名的交易，写入文件
+func (cli *CLI) createMultisigTransaction(from string, to string, amount Amount, fee Amount, selector CoinSelector, file string) {
+	if !IsValidAddress(from) {
+		fmt.Println("传入from地址无效")
+		return
+	}
+	if !IsValidAddress(to) {
+		fmt.Println("传入to地址无效")
+		return
+	}
+
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	tx := NewMultisigTransaction(from, []Payment{{Address: to, Amount: amount}}, fee, selector, bc)
+	if tx == nil {
+		fmt.Println("未找到有效交易")
+		return
+	}
+	err = writeTransactionFile(file, tx)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("待签名交易已写入%s: %x\n", file, tx.TXID)
+}
+
+//使用钱包中的私钥对文件中的多重签名交易签名，写回文件
+func (cli *CLI) signMultisigTransaction(file string) {
+	tx, err := readTransactionFile(file)
+	if err != nil {
+		fmt.Println("读取交易失败:", err)
+		return
+	}
+	wm := NewWalletManager()
+	if wm == nil {
+		fmt.Println("打开钱包失败")
+		return
+	}
+	added, err := tx.SignMultisig(wm)
+	if err != nil {
+		fmt.Println("签名失败:", err)
+		return
+	}
+	if added == 0 {
+		fmt.Println("钱包中没有需要签名的私钥")
+		return
+	}
+	err = writeTransactionFile(file, tx)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("新增%d个签名\n", added)
+	progress, _ := tx.multisigProgress()
+	for _, line := range progress {
+		fmt.Println(line)
+	}
+}
+
+//签名足够后完成多重签名交易，校验通过后放入内存池
+func (cli *CLI) sendMultisigTransaction(file string) {
+	tx, err := readTransactionFile(file)
+	if err != nil {
+		fmt.Println("读取交易失败:", err)
+		return
+	}
+	err = tx.FinalizeMultisig()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	mp, err := bc.LoadMempool()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	err = bc.AcceptToMempool(mp, tx)
+	if err != nil {
+		fmt.Println("转账失败:", err)
+		return
+	}
+	fmt.Printf("转账成功，交易已放入内存池: %x\n", tx.TXID)
+}
+
+//文件存证：文件哈希写入数据output，交易放入内存池
+func (cli *CLI) notarize(from string, file string, fee Amount, selector CoinSelector) {
+	if !IsValidAddress(from) {
+		fmt.Println("传入from地址无效")
+		return
+	}
+	digest, err := fileDigest(file)
+	if err != nil {
+		fmt.Println("读取文件失败:", err)
+		return
+	}
+
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	tx := NewNotaryTransaction(from, digest, fee, selector, bc)
+	if tx == nil {
+		fmt.Println("未找到有效交易")
+		return
+	}
+
+	mp, err := bc.LoadMempool()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	err = bc.AcceptToMempool(mp, tx)
+	if err != nil {
+		fmt.Println("存证失败:", err)
+		return
+	}
+	fmt.Printf("文件哈希: %x\n", digest)
+	fmt.Printf("存证成功，交易已放入内存池: %x\n", tx.TXID)
+}
+
+//查询文件存证：输出文件哈希所在的交易和区块
+func (cli *CLI) verifyNotary(file string) {
+	digest, err := fileDigest(file)
+	if err != nil {
+		fmt.Println("读取文件失败:", err)
+		return
+	}
+	fmt.Printf("文件哈希: %x\n", digest)
+
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer bc.db.Close()
+
+	record, err := bc.FindNotary(digest)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("交易: %x\n", record.Tx.TXID)
+	if record.Block == nil {
+		fmt.Println("交易在内存池中，尚未上链")
+		return
+	}
+	bestHeight, err := bc.GetBestHeight()
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
+	fmt.Printf("区块高度: %d\n", record.Block.Height)
+	fmt.Printf("区块哈希: %x\n", record.Block.Hash)
+	fmt.Printf("区块时间: %s\n", time.Unix(blockTimeSeconds(record.Block), 0).Format("2006-01-02 15:04:05"))
+	fmt.Printf("确认数: %d\n", bestHeight-record.Block.Height+1)
 }
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+/*
+	难度调整：
+		区块的Bits字段以压缩格式保存目标值：最高字节为指数，低3字节为尾数，
+		目标值 = 尾数 * 256^(指数-3)。
+		每隔RetargetInterval个区块，根据上一个周期实际花费的时间调整目标值：
+			新目标值 = 旧目标值 * 实际时间 / 期望时间
+		实际时间限制在期望时间的1/4到4倍之间，新目标值不能超过网络的难度上限。
+*/
+
+//旧版本区块的Bits为0，使用最初写死的目标值0x0001000...
+const legacyBits = 0x1f010000
+
+//CompactToBig 将压缩格式的难度转换为目标值
+func CompactToBig(compact uint64) *big.Int {
+	//尾数（低23位，第24位为符号位，目标值不会为负数）
+	mantissa := compact & 0x007fffff
+	//指数
+	exponent := uint(compact>>24) & 0xff
+
+	var target *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		target = new(big.Int).SetUint64(mantissa)
+	} else {
+		target = new(big.Int).SetUint64(mantissa)
+		target.Lsh(target, 8*(exponent-3))
+	}
+	return target
+}
+
+//BigToCompact 将目标值转换为压缩格式的难度
+func BigToCompact(target *big.Int) uint64 {
+	if target.Sign() <= 0 {
+		return 0
+	}
+
+	var mantissa uint64
+	exponent := uint(len(target.Bytes()))
+	if exponent <= 3 {
+		mantissa = target.Uint64() << (8 * (3 - exponent))
+	} else {
+		tmp := new(big.Int).Rsh(target, 8*(exponent-3))
+		mantissa = tmp.Uint64()
+	}
+
+	//尾数最高位为符号位，需要右移一个字节并增加指数
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+	return uint64(exponent)<<24 | mantissa
+}
+
+//calcNextBits 在数据库事务中计算下一个区块需要满足的难度
+func calcNextBits(tx *bolt.Tx, prevBlock *Block) (uint64, error) {
+	params := activeNetParams
+
+	//创世块和关闭难度调整的网络使用最低难度
+	if prevBlock == nil || params.NoRetargeting {
+		return params.PowLimitBits, nil
+	}
+	prevBits := prevBlock.Bits
+	if prevBits == 0 {
+		prevBits = legacyBits
+	}
+
+	//不在调整周期的边界上，沿用前一个区块的难度
+	height := prevBlock.Height + 1
+	if height%params.RetargetInterval != 0 {
+		return prevBits, nil
+	}
+
+	//上一个周期的第一个区块
+	firstHash := getBlockHash(tx, height-params.RetargetInterval)
+	if firstHash == nil {
+		return 0, errors.New("高度索引不存在，请执行reindexheight")
+	}
+	firstBlock := getBlock(tx, firstHash)
+	if firstBlock == nil {
+		return 0, errors.New("读取区块失败")
+	}
+
+	//实际时间（区块时间戳为纳秒），限制在期望时间的1/4到4倍之间
+	expected := params.TargetBlockTime * time.Duration(params.RetargetInterval)
+	actual := time.Duration(prevBlock.TimeStamp - firstBlock.TimeStamp)
+	if prevBlock.TimeStamp < firstBlock.TimeStamp || actual < expected/4 {
+		actual = expected / 4
+	}
+	if actual > expected*4 {
+		actual = expected * 4
+	}
+
+	//新目标值 = 旧目标值 * 实际时间 / 期望时间
+	target := CompactToBig(prevBits)
+	target.Mul(target, big.NewInt(int64(actual)))
+	target.Div(target, big.NewInt(int64(expected)))
+
+	//不能超过难度上限
+	powLimit := CompactToBig(params.PowLimitBits)
+	if target.Cmp(powLimit) > 0 {
+		target = powLimit
+	}
+	return BigToCompact(target), nil
+}
+
+//GetNextBits 计算下一个区块需要满足的难度
+func (bc *BlockChain) GetNextBits() (uint64, error) {
+	var bits uint64
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		prevBlock := getBlock(tx, bc.tail)
+		if prevBlock == nil {
+			return errors.New("读取最后一个区块失败")
+		}
+		var err error
+		bits, err = calcNextBits(tx, prevBlock)
+		return err
+	})
+	return bits, err
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/tyler-smith/go-bip39"
+)
+
+/*
+	HD钱包（分层确定性钱包）：
+		助记词（BIP39）：随机生成128位熵，编码为12个英文单词，
+			助记词经过PBKDF2-HMAC-SHA512（盐为"mnemonic"，2048次）得到64字节的种子。
+		主密钥（BIP32）：HMAC-SHA512("Bitcoin seed", 种子)，前32字节为私钥，后32字节为链码。
+		子密钥：HMAC-SHA512(父链码, 数据)，前32字节与父私钥相加(mod n)得到子私钥，后32字节为子链码，
+			索引>=2^31为强化派生，数据为 0x00||父私钥||索引，否则为 父压缩公钥||索引。
+		派生路径（BIP44）：m/44'/币种'/账户'/链/索引
+			币种由网络决定（主网0，测试网络1），链0为收款地址，链1为找零地址。
+		钱包为每个账户记录两条链下一个未使用的索引：createwallet派生下一个收款地址，
+		sendfromwallet默认找零到下一个找零地址，因此只要备份一次助记词，就能恢复之后创建的所有地址。
+	恢复：
+		restorewallet遍历账本收集出现过的公钥哈希，依次派生每个账户两条链的地址，
+		连续20个地址都没有出现过时停止（gap limit），没有使用过的账户之后不再查找。
+	HD钱包只支持secp256k1签名方案，公钥为压缩格式；createwallet --uncompressed仍创建随机的独立私钥。
+*/
+
+//HD钱包错误
+var (
+	ErrHDMnemonic   = errors.New("助记词无效")
+	ErrHDExists     = errors.New("钱包已有HD种子，不能再恢复其他助记词")
+	ErrHDScheme     = errors.New("HD钱包只支持secp256k1签名方案")
+	errHDInvalidKey = errors.New("派生的私钥无效")
+)
+
+//派生参数
+const (
+	hdHardened uint32 = 1 << 31 //强化派生的起始索引
+	hdPurpose  uint32 = 44      //BIP44
+	hdExternal uint32 = 0       //收款链
+	hdInternal uint32 = 1       //找零链
+	hdGapLimit        = 20      //恢复时连续未使用地址的上限
+	hdEntropy         = 128     //助记词的熵（位）
+)
+
+//HDChain HD钱包的种子和每个账户的派生状态
+type HDChain struct {
+	Seed          []byte                //种子（钱包加密后只在解锁时存在于内存中）
+	EncryptedSeed []byte                //加密后的种子（钱包未加密时为空）
+	Accounts      map[string]*HDAccount //key为账户的派生路径，例如m/44'/0'/0'
+}
+
+//HDAccount 账户的收款链和找零链下一个未使用的索引
+type HDAccount struct {
+	Next [2]uint32
+}
+
+//extendedKey BIP32扩展私钥
+type extendedKey struct {
+	key       []byte //私钥（32字节）
+	chainCode []byte //链码（32字节）
+}
+
+//newMnemonic 生成新的助记词
+func newMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(hdEntropy)
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+//mnemonicToSeed 校验助记词（单词和校验码）并计算种子（不使用额外的密码）
+func mnemonicToSeed(mnemonic string) ([]byte, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(strings.Join(strings.Fields(mnemonic), " "), "")
+	if err != nil {
+		return nil, ErrHDMnemonic
+	}
+	return seed, nil
+}
+
+//newExtendedKey 由HMAC-SHA512的结果创建扩展私钥，parent不为nil时私钥与父私钥相加
+func newExtendedKey(sum []byte, parent []byte) (*extendedKey, error) {
+	var key secp256k1.ModNScalar
+	if key.SetByteSlice(sum[:32]) {
+		return nil, errHDInvalidKey
+	}
+	if parent != nil {
+		var parentKey secp256k1.ModNScalar
+		parentKey.SetByteSlice(parent)
+		key.Add(&parentKey)
+	}
+	if key.IsZero() {
+		return nil, errHDInvalidKey
+	}
+	keyBytes := key.Bytes()
+	return &extendedKey{keyBytes[:], sum[32:]}, nil
+}
+
+//newMasterKey 由种子计算主密钥
+func newMasterKey(seed []byte) (*extendedKey, error) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	return newExtendedKey(mac.Sum(nil), nil)
+}
+
+//child 派生索引为index的子私钥
+func (k *extendedKey) child(index uint32) (*extendedKey, error) {
+	var data []byte
+	if index >= hdHardened {
+		data = append([]byte{0x00}, k.key...)
+	} else {
+		data = secp256k1.PrivKeyFromBytes(k.key).PubKey().SerializeCompressed()
+	}
+	var indexBytes [4]byte
+	binary.BigEndian.PutUint32(indexBytes[:], index)
+	data = append(data, indexBytes[:]...)
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	return newExtendedKey(mac.Sum(nil), k.key)
+}
+
+//hdAccountPath 账户的派生路径：m/44'/币种'/账户'
+func hdAccountPath(account uint32) string {
+	return fmt.Sprintf("m/%d'/%d'/%d'", hdPurpose, activeNetParams.HDCoinType, account)
+}
+
+//initHDChain 使用种子创建HD钱包，已加密的钱包同时加密种子（需要先解锁）
+func (wm *WalletManager) initHDChain(seed []byte) error {
+	if activeNetParams.Scheme.Name() != SchemeSecp256k1 {
+		return ErrHDScheme
+	}
+	if wm.isLocked() {
+		return ErrWalletLocked
+	}
+	hd := HDChain{Seed: seed, Accounts: make(map[string]*HDAccount)}
+	if wm.isEncrypted() {
+		var err error
+		hd.EncryptedSeed, err = sealData(wm.key, seed, nil)
+		if err != nil {
+			return err
+		}
+	}
+	wm.HD = &hd
+	return nil
+}
+
+//deriveHDWallet 派生 m/44'/币种'/account'/chain/index 的钱包
+func (wm *WalletManager) deriveHDWallet(account uint32, chain uint32, index uint32) (*Wallet, error) {
+	if wm.HD.Seed == nil {
+		return nil, ErrWalletLocked
+	}
+	key, err := newMasterKey(wm.HD.Seed)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range []uint32{hdPurpose | hdHardened, activeNetParams.HDCoinType | hdHardened, account | hdHardened, chain, index} {
+		key, err = key.child(i)
+		if err != nil {
+			return nil, err
+		}
+	}
+	pubKey, err := activeNetParams.Scheme.PublicKey(key.key, true)
+	if err != nil {
+		return nil, err
+	}
+	w := Wallet{
+		Scheme:     activeNetParams.Scheme.Name(),
+		PrivateKey: key.key,
+		PublicKey:  pubKey,
+		HDPath:     fmt.Sprintf("%s/%d/%d", hdAccountPath(account), chain, index),
+	}
+	if wm.isEncrypted() {
+		w.EncryptedKey, err = sealData(wm.key, w.PrivateKey, w.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &w, nil
+}
+
+//hdNextIndex 账户中chain链下一个未使用的索引
+func (wm *WalletManager) hdNextIndex(account uint32, chain uint32) uint32 {
+	if acc := wm.HD.Accounts[hdAccountPath(account)]; acc != nil {
+		return acc.Next[chain]
+	}
+	return 0
+}
+
+//nextHDWallet 派生账户中chain链下一个未使用索引的钱包，加入钱包管理（不保存文件）
+func (wm *WalletManager) nextHDWallet(account uint32, chain uint32) (*Wallet, error) {
+	path := hdAccountPath(account)
+	acc := wm.HD.Accounts[path]
+	if acc == nil {
+		acc = &HDAccount{}
+	}
+	for {
+		w, err := wm.deriveHDWallet(account, chain, acc.Next[chain])
+		acc.Next[chain]++
+		//派生的私钥无效时使用下一个索引
+		if err == errHDInvalidKey {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		wm.HD.Accounts[path] = acc
+		wm.Wallets[w.getAddress()] = w
+		return w, nil
+	}
+}
+
+//newHDAddress 派生新的地址并保存钱包：chain为hdExternal时是收款地址，hdInternal时是找零地址
+func (wm *WalletManager) newHDAddress(account uint32, chain uint32) (string, error) {
+	if wm.HD == nil {
+		return "", errors.New("钱包没有HD种子")
+	}
+	if account >= hdHardened {
+		return "", errors.New("账户编号无效")
+	}
+	w, err := wm.nextHDWallet(account, chain)
+	if err != nil {
+		return "", err
+	}
+	if !wm.saveFile() {
+		return "", errors.New("保存钱包失败")
+	}
+	return w.getAddress(), nil
+}
+
+//restoreHD 由助记词恢复HD钱包：used为链上出现过的公钥哈希，返回恢复的地址
+func (wm *WalletManager) restoreHD(mnemonic string, used map[string]bool) ([]string, error) {
+	if wm.HD != nil {
+		return nil, ErrHDExists
+	}
+	seed, err := mnemonicToSeed(mnemonic)
+	if err != nil {
+		return nil, err
+	}
+	err = wm.initHDChain(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	var restored []string
+	for account := uint32(0); account < hdHardened; account++ {
+		found := false
+		for _, chain := range []uint32{hdExternal, hdInternal} {
+			gap := 0
+			for index := uint32(0); gap < hdGapLimit; index++ {
+				w, err := wm.deriveHDWallet(account, chain, index)
+				if err == errHDInvalidKey {
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+				if !used[string(GetPubKeyHashFromPublicKey(w.PublicKey))] {
+					gap++
+					continue
+				}
+				//补齐该地址之前的所有地址，保持索引连续
+				gap = 0
+				found = true
+				for wm.hdNextIndex(account, chain) <= index {
+					w, err := wm.nextHDWallet(account, chain)
+					if err != nil {
+						return nil, err
+					}
+					restored = append(restored, w.getAddress())
+				}
+			}
+		}
+		if !found {
+			break
+		}
+	}
+
+	//账户0至少有一个收款地址
+	if wm.HD.Accounts[hdAccountPath(0)] == nil {
+		w, err := wm.nextHDWallet(0, hdExternal)
+		if err != nil {
+			return nil, err
+		}
+		restored = append(restored, w.getAddress())
+	}
+	if !wm.saveFile() {
+		return nil, errors.New("保存钱包失败")
+	}
+	return restored, nil
+}
+
+//usedPubKeyHashes 遍历账本，收集所有P2PKH output中出现过的公钥哈希
+func (bc *BlockChain) usedPubKeyHashes() (map[string]bool, error) {
+	used := make(map[string]bool)
+	it := bc.NewIterator()
+	for {
+		block := it.Next()
+		if block == nil {
+			return nil, errors.New("读取区块失败")
+		}
+		for _, tx := range block.Transactions {
+			for _, output := range tx.TXOutputs {
+				if hash := extractPubKeyHash(output.ScriptPubKey); hash != nil {
+					used[string(hash)] = true
+				}
+			}
+		}
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+	return used, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/boltdb/bolt"
+)
+
+/*
+	区块高度索引：
+		key为区块高度，value为区块哈希，
+		用于根据高度查询区块，以及从创世块向最后一个区块正向遍历。
+*/
+
+//区块高度索引数据桶
+const heightBucket = "heightBucket"
+
+//updateHeightIndex 将区块高度写入高度索引
+func updateHeightIndex(bucket *bolt.Bucket, block *Block) error {
+	return bucket.Put(UintToByteSlice(block.Height), block.Hash)
+}
+
+//getBlockHash 在数据库事务中根据高度获取区块哈希，没有找到返回nil
+func getBlockHash(tx *bolt.Tx, height uint64) []byte {
+	bucket := tx.Bucket([]byte(heightBucket))
+	if bucket == nil {
+		return nil
+	}
+	hash := bucket.Get(UintToByteSlice(height))
+	if hash == nil {
+		return nil
+	}
+	return append([]byte{}, hash...)
+}
+
+//GetBlock 根据哈希获取区块
+func (bc *BlockChain) GetBlock(hash []byte) (*Block, error) {
+	var block *Block
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		block = getBlock(tx, hash)
+		if block == nil {
+			return errors.New("没有找到区块")
+		}
+		return nil
+	})
+	return block, err
+}
+
+//GetBlockHash 根据高度获取区块哈希
+func (bc *BlockChain) GetBlockHash(height uint64) ([]byte, error) {
+	var hash []byte
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(heightBucket)) == nil {
+			return errors.New("高度索引不存在，请执行reindexheight")
+		}
+		hash = getBlockHash(tx, height)
+		if hash == nil {
+			return errors.New("没有找到该高度的区块")
+		}
+		return nil
+	})
+	return hash, err
+}
+
+//GetBlockByHeight 根据高度获取区块
+func (bc *BlockChain) GetBlockByHeight(height uint64) (*Block, error) {
+	hash, err := bc.GetBlockHash(height)
+	if err != nil {
+		return nil, err
+	}
+	return bc.GetBlock(hash)
+}
+
+//GetBlockHeight 获取区块高度（创世块高度为0）
+func (bc *BlockChain) GetBlockHeight(hash []byte) (uint64, error) {
+	block, err := bc.GetBlock(hash)
+	if err != nil {
+		return 0, err
+	}
+	return block.Height, nil
+}
+
+//GetBestHeight 获取最后一个区块的高度
+func (bc *BlockChain) GetBestHeight() (uint64, error) {
+	return bc.GetBlockHeight(bc.tail)
+}
+
+//ForwardIterator 正向迭代器（从创世块遍历到最后一个区块）
+type ForwardIterator struct {
+	db            *bolt.DB
+	currentHeight uint64 //游标：不断增加的区块高度
+}
+
+//NewForwardIterator 初始化正向迭代器的方法
+func (bc *BlockChain) NewForwardIterator() *ForwardIterator {
+	it := ForwardIterator{
+		db:            bc.db,
+		currentHeight: 0, //创世块高度
+	}
+	return &it
+}
+
+//Next 正向迭代器Next方法，返回当前高度的区块并将游标指向下一个高度，遍历结束返回nil
+func (it *ForwardIterator) Next() (block *Block) {
+	it.db.View(func(tx *bolt.Tx) error {
+		hash := getBlockHash(tx, it.currentHeight)
+		if hash == nil {
+			return nil
+		}
+		block = getBlock(tx, hash)
+		return nil
+	})
+	if block != nil {
+		it.currentHeight++
+	}
+	return
+}
+
+//ReindexHeights 遍历账本为区块重新计算高度并重建高度索引
+func (bc *BlockChain) ReindexHeights() (uint64, error) {
+	var bestHeight uint64 //最后一个区块的高度
+
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		blocks := tx.Bucket([]byte(blockBucket))
+		if blocks == nil {
+			return errors.New("No bucket")
+		}
+
+		//从最后一个区块回溯到创世块，得到正向的区块哈希集合
+		var hashes [][]byte
+		for hash := bc.tail; len(hash) != 0; {
+			block := getBlock(tx, hash)
+			if block == nil {
+				return errors.New("读取区块失败")
+			}
+			hashes = append([][]byte{hash}, hashes...)
+			hash = block.PrevHash
+		}
+
+		//删除旧的高度索引
+		if tx.Bucket([]byte(heightBucket)) != nil {
+			err := tx.DeleteBucket([]byte(heightBucket))
+			if err != nil {
+				return err
+			}
+		}
+		bucket, err := tx.CreateBucket([]byte(heightBucket))
+		if err != nil {
+			return err
+		}
+
+		//高度不参与哈希计算，直接重写区块数据
+		for height, hash := range hashes {
+			block := getBlock(tx, hash)
+			block.Height = uint64(height)
+			err := blocks.Put(hash, block.Serialize())
+			if err != nil {
+				return err
+			}
+			err = updateHeightIndex(bucket, block)
+			if err != nil {
+				return err
+			}
+			bestHeight = block.Height
+		}
+		return nil
+	})
+	return bestHeight, err
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+)
+
+/*
+	地址历史（rescan）：
+		余额由UTXO集直接查询，新导入的地址不需要重建UTXO集；
+		历史记录需要从创世块开始按高度遍历账本：
+			output的锁定脚本为地址的脚本时记为收入，
+			input引用了之前记为收入的output时记为支出。
+*/
+
+//HistoryEntry 地址在一笔交易中的收支
+type HistoryEntry struct {
+	TXID     []byte //交易ID
+	Height   uint64 //交易所在区块的高度
+	Received Amount //收入：付款给地址的output金额之和
+	Spent    Amount //支出：花费的地址output金额之和
+}
+
+//AddressHistory 按高度遍历账本，查询锁定脚本为script的收支记录
+func (bc *BlockChain) AddressHistory(script []byte) ([]HistoryEntry, error) {
+	return bc.ScriptsHistory([][]byte{script})
+}
+
+//ScriptsHistory 按高度遍历账本，查询锁定脚本属于scripts的收支记录
+func (bc *BlockChain) ScriptsHistory(scripts [][]byte) ([]HistoryEntry, error) {
+	wanted := make(map[string]bool)
+	for _, script := range scripts {
+		wanted[string(script)] = true
+	}
+	var history []HistoryEntry
+	var lastHash []byte              //遍历到的最后一个区块的哈希
+	owned := make(map[string]Amount) //地址收到的output（key为utxoKey）
+	it := bc.NewForwardIterator()
+	for block := it.Next(); block != nil; block = it.Next() {
+		for _, blockTX := range block.Transactions {
+			entry := HistoryEntry{TXID: blockTX.TXID, Height: block.Height}
+			var err error
+			if !blockTX.isCoinBaseTX() {
+				for _, input := range blockTX.TXInputs {
+					key := string(utxoKey(input.TXID, input.Index))
+					if value, ok := owned[key]; ok {
+						entry.Spent, err = AddAmount(entry.Spent, value)
+						if err != nil {
+							return nil, err
+						}
+						delete(owned, key)
+					}
+				}
+			}
+			for i, output := range blockTX.TXOutputs {
+				if wanted[string(output.ScriptPubKey)] {
+					entry.Received, err = AddAmount(entry.Received, output.Value)
+					if err != nil {
+						return nil, err
+					}
+					owned[string(utxoKey(blockTX.TXID, int64(i)))] = output.Value
+				}
+			}
+			if entry.Received != 0 || entry.Spent != 0 {
+				history = append(history, entry)
+			}
+		}
+		lastHash = block.Hash
+	}
+	//高度索引缺失时正向迭代器提前结束
+	if !bytes.Equal(lastHash, bc.tail) {
+		return nil, errors.New("高度索引不完整，请执行reindexheight")
+	}
+	return history, nil
+}
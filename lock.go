@@ -0,0 +1,132 @@
+package main
+
+import "github.com/boltdb/bolt"
+
+/*
+	交易锁定：
+		锁定时间（LockTime，绝对锁定）：
+			0为不锁定；小于500000000时为区块高度，交易只能放入高度大于该值的区块；
+			否则为unix时间（秒），交易只能放入中位时间大于该值的区块。
+			所有input的序号都为SequenceFinal时锁定时间不生效。
+		相对锁定（input的序号，与比特币的BIP68相同）：
+			第31位为1时不锁定（SequenceFinal也不锁定）；
+			第22位为0时，低16位为区块个数：引用的output被确认后，至少再经过这么多个区块才能花费；
+			第22位为1时，低16位以512秒为单位：从引用的output所在区块的前一个区块的中位时间算起。
+		中位时间（median time past）为最近11个区块时间戳的中位数（秒），
+		比单个区块的时间戳更难被矿工操纵。
+		未到锁定时间的交易可以放入内存池等待，挖矿时跳过，区块中包含这样的交易时整个区块无效。
+*/
+
+//相对锁定的序号格式
+const (
+	SequenceLockTimeDisabled    uint32 = 1 << 31 //不启用相对锁定
+	SequenceLockTimeIsSeconds   uint32 = 1 << 22 //按时间锁定
+	SequenceLockTimeMask        uint32 = 0x0000ffff
+	SequenceLockTimeGranularity        = 9 //时间单位为2^9=512秒
+)
+
+//TxLock 创建交易时的锁定条件（零值为不锁定）
+type TxLock struct {
+	LockTime uint32 //交易的锁定时间，不为0时input的序号设为SequenceFinal-1使其生效
+	Sequence uint32 //input的序号（相对锁定），不为0时优先使用
+}
+
+//apply 将锁定条件写入交易的LockTime和每个input的序号
+func (lock TxLock) apply(tx *Transaction) {
+	sequence := SequenceFinal
+	if lock.Sequence != 0 {
+		sequence = lock.Sequence
+	} else if lock.LockTime != 0 {
+		sequence = SequenceFinal - 1
+	}
+	tx.LockTime = lock.LockTime
+	for i := range tx.TXInputs {
+		tx.TXInputs[i].Sequence = sequence
+	}
+}
+
+//blockTimeSeconds 区块时间戳（纳秒）转换为秒
+func blockTimeSeconds(block *Block) int64 {
+	return int64(block.TimeStamp / 1e9)
+}
+
+//medianTimePast 在数据库事务中计算以block结尾的最近11个区块的中位时间（秒）
+func medianTimePast(tx *bolt.Tx, block *Block) int64 {
+	return int64(medianTimestamp(tx, block) / 1e9)
+}
+
+//IsFinal 判断交易在高度为height、中位时间为blockTime的区块中是否已到锁定时间
+func (tx *Transaction) IsFinal(height uint64, blockTime int64) bool {
+	if tx.LockTime == 0 {
+		return true
+	}
+	if tx.LockTime < lockTimeThreshold {
+		if uint64(tx.LockTime) < height {
+			return true
+		}
+	} else if int64(tx.LockTime) < blockTime {
+		return true
+	}
+	//所有input的序号都为最终值时锁定时间不生效
+	for _, input := range tx.TXInputs {
+		if input.Sequence != SequenceFinal {
+			return false
+		}
+	}
+	return true
+}
+
+//checkTransactionLocks 在数据库事务中校验交易能否放入高度为height的区块
+//prevBlock为前一个区块，view中区块内已处理的交易视为在当前区块确认
+func checkTransactionLocks(tx *bolt.Tx, view *utxoView, transaction *Transaction, height uint64, prevBlock *Block) error {
+	if transaction.isCoinBaseTX() {
+		return nil
+	}
+	mtp := medianTimePast(tx, prevBlock)
+	if !transaction.IsFinal(height, mtp) {
+		return ErrTXNotFinal
+	}
+
+	for _, input := range transaction.TXInputs {
+		if input.Sequence&SequenceLockTimeDisabled != 0 {
+			continue
+		}
+		value := int64(input.Sequence & SequenceLockTimeMask)
+
+		//引用的output被确认的高度（区块内的交易为当前高度）
+		prevHeight := height
+		if view.txs[string(input.TXID)] == nil {
+			location := findTXLocation(tx, input.TXID)
+			if location == nil {
+				return ErrTXMissingInput
+			}
+			prevOutBlock := getBlock(tx, location.BlockHash)
+			if prevOutBlock == nil {
+				return ErrTXMissingInput
+			}
+			prevHeight = prevOutBlock.Height
+		}
+
+		if input.Sequence&SequenceLockTimeIsSeconds == 0 {
+			//按区块个数：当前高度 >= 确认高度 + value
+			if height < prevHeight+uint64(value) {
+				return ErrTXSequenceLock
+			}
+			continue
+		}
+
+		//按时间：从确认区块的前一个区块的中位时间算起
+		var coinTime int64
+		if prevHeight > 0 {
+			coinBlock := getBlock(tx, getBlockHash(tx, prevHeight-1))
+			if coinBlock == nil {
+				return ErrTXMissingInput
+			}
+			coinTime = medianTimePast(tx, coinBlock)
+		}
+		if mtp < coinTime+value<<SequenceLockTimeGranularity {
+			return ErrTXSequenceLock
+		}
+	}
+	return nil
+}
@@ -1,7 +1,16 @@
 package main
 
+import "fmt"
+
 func main() {
 
+	//选择网络
+	err := SelectNetworkFromEnv()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
 	//创建命令行
 	cli := CLI{}
 	//解析用户输入
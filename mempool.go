@@ -0,0 +1,365 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/boltdb/bolt"
+)
+
+/*
+	内存池：
+		转账时创建的交易经过校验后放入内存池，不再立即挖矿；
+		挖矿时按手续费率（每千字节的手续费）从高到低选择交易打包成区块，多笔转账可以共享一个区块。
+		内存池在内存中维护，同时持久化到数据库的mempoolBucket中，命令行每次执行时从数据库加载。
+		内存池中的交易只能引用已上链的output，且不能与池中其他交易消耗同一个output。
+*/
+
+//内存池数据桶
+const mempoolBucket = "mempoolBucket"
+
+//区块中交易的最大字节数
+const maxBlockSize = 1000000
+
+//内存池错误
+var (
+	ErrMempoolCoinbase  = errors.New("挖矿交易不能放入内存池")
+	ErrMempoolDuplicate = errors.New("交易已在内存池中")
+	ErrMempoolConflict  = errors.New("与内存池中的交易消耗同一个output")
+)
+
+//MempoolEntry 内存池中的交易
+type MempoolEntry struct {
+	Tx   *Transaction //交易
+	Fee  Amount       //手续费
+	Size int          //交易字节数
+}
+
+//FeeRate 手续费率（每千字节的手续费）
+func (entry *MempoolEntry) FeeRate() Amount {
+	if entry.Size == 0 {
+		return 0
+	}
+	return entry.Fee * 1000 / Amount(entry.Size)
+}
+
+//Mempool 内存池
+type Mempool struct {
+	entries map[string]*MempoolEntry //池中的交易（key为交易ID）
+	spent   map[string]string        //池中交易消耗的output（key为utxoKey，value为交易ID）
+}
+
+//NewMempool 创建一个空的内存池
+func NewMempool() *Mempool {
+	mp := Mempool{
+		entries: make(map[string]*MempoolEntry),
+		spent:   make(map[string]string),
+	}
+	return &mp
+}
+
+//Count 内存池中的交易个数
+func (mp *Mempool) Count() int {
+	return len(mp.entries)
+}
+
+//Has 判断交易是否在内存池中
+func (mp *Mempool) Has(txid []byte) bool {
+	_, ok := mp.entries[string(txid)]
+	return ok
+}
+
+//IsSpent 判断output是否已被内存池中的交易消耗
+func (mp *Mempool) IsSpent(txid []byte, index int64) bool {
+	_, ok := mp.spent[string(utxoKey(txid, index))]
+	return ok
+}
+
+//add 将交易放入内存池，拒绝重复和冲突的交易
+func (mp *Mempool) add(entry *MempoolEntry) error {
+	tx := entry.Tx
+	if mp.Has(tx.TXID) {
+		return ErrMempoolDuplicate
+	}
+	for _, input := range tx.TXInputs {
+		if mp.IsSpent(input.TXID, input.Index) {
+			return ErrMempoolConflict
+		}
+	}
+	for _, input := range tx.TXInputs {
+		mp.spent[string(utxoKey(input.TXID, input.Index))] = string(tx.TXID)
+	}
+	mp.entries[string(tx.TXID)] = entry
+	return nil
+}
+
+//remove 将交易移出内存池
+func (mp *Mempool) remove(txid []byte) {
+	entry, ok := mp.entries[string(txid)]
+	if !ok {
+		return
+	}
+	for _, input := range entry.Tx.TXInputs {
+		delete(mp.spent, string(utxoKey(input.TXID, input.Index)))
+	}
+	delete(mp.entries, string(txid))
+}
+
+//removeBlock 将区块中的交易以及与区块冲突的交易移出内存池
+func (mp *Mempool) removeBlock(block *Block) {
+	for _, tx := range block.Transactions {
+		mp.remove(tx.TXID)
+		if tx.isCoinBaseTX() {
+			continue
+		}
+		for _, input := range tx.TXInputs {
+			if txid, ok := mp.spent[string(utxoKey(input.TXID, input.Index))]; ok {
+				mp.remove([]byte(txid))
+			}
+		}
+	}
+}
+
+//Entries 获取内存池中的交易，按手续费率从高到低排序
+func (mp *Mempool) Entries() []*MempoolEntry {
+	var entries []*MempoolEntry
+	for _, entry := range mp.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		//交叉相乘比较手续费率，避免整数除法的误差
+		left := entries[i].Fee * Amount(entries[j].Size)
+		right := entries[j].Fee * Amount(entries[i].Size)
+		if left != right {
+			return left > right
+		}
+		return string(entries[i].Tx.TXID) < string(entries[j].Tx.TXID)
+	})
+	return entries
+}
+
+//checkMempoolTransaction 在数据库事务中校验交易能否放入内存池
+func checkMempoolTransaction(tx *bolt.Tx, mp *Mempool, transaction *Transaction) (*MempoolEntry, error) {
+	if transaction.isCoinBaseTX() {
+		return nil, ErrMempoolCoinbase
+	}
+	if mp.Has(transaction.TXID) {
+		return nil, ErrMempoolDuplicate
+	}
+	for _, input := range transaction.TXInputs {
+		if mp.IsSpent(input.TXID, input.Index) {
+			return nil, ErrMempoolConflict
+		}
+	}
+
+	//与区块中的交易使用相同的校验规则
+	view, err := newUTXOView(tx)
+	if err != nil {
+		return nil, err
+	}
+	fee, err := validateTransaction(tx, view, transaction)
+	if err != nil {
+		return nil, err
+	}
+	entry := MempoolEntry{
+		Tx:   transaction,
+		Fee:  fee,
+		Size: len(transaction.Serialize()),
+	}
+	return &entry, nil
+}
+
+//LoadMempool 从数据库加载内存池，已失效的交易（已上链或与链上交易冲突）会被删除
+func (bc *BlockChain) LoadMempool() (*Mempool, error) {
+	mp := NewMempool()
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(mempoolBucket))
+		if err != nil {
+			return err
+		}
+
+		var invalid [][]byte //失效的交易ID
+		err = bucket.ForEach(func(k, v []byte) error {
+			transaction := DeSerializeTransaction(v)
+			if transaction == nil {
+				invalid = append(invalid, append([]byte{}, k...))
+				return nil
+			}
+			entry, err := checkMempoolTransaction(tx, mp, transaction)
+			if err != nil {
+				invalid = append(invalid, append([]byte{}, k...))
+				return nil
+			}
+			return mp.add(entry)
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, txid := range invalid {
+			err := bucket.Delete(txid)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mp, nil
+}
+
+//AcceptToMempool 校验交易并放入内存池，同时写入数据库
+func (bc *BlockChain) AcceptToMempool(mp *Mempool, transaction *Transaction) error {
+	return bc.db.Update(func(tx *bolt.Tx) error {
+		entry, err := checkMempoolTransaction(tx, mp, transaction)
+		if err != nil {
+			return err
+		}
+		bucket, err := tx.CreateBucketIfNotExists([]byte(mempoolBucket))
+		if err != nil {
+			return err
+		}
+		err = bucket.Put(transaction.TXID, transaction.Serialize())
+		if err != nil {
+			return err
+		}
+		return mp.add(entry)
+	})
+}
+
+//mempoolSpentOutputs 获取数据库中内存池交易已消耗的output（key为utxoKey）
+func (bc *BlockChain) mempoolSpentOutputs() map[string]bool {
+	spent := make(map[string]bool)
+	bc.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(mempoolBucket))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			transaction := DeSerializeTransaction(v)
+			if transaction == nil {
+				return nil
+			}
+			for _, input := range transaction.TXInputs {
+				spent[string(utxoKey(input.TXID, input.Index))] = true
+			}
+			return nil
+		})
+	})
+	return spent
+}
+
+//removeBlockFromMempool 在数据库事务中将区块中的交易以及与区块冲突的交易移出内存池
+func removeBlockFromMempool(tx *bolt.Tx, block *Block) error {
+	bucket := tx.Bucket([]byte(mempoolBucket))
+	if bucket == nil {
+		return nil
+	}
+
+	//区块消耗的output
+	spentByBlock := make(map[string]bool)
+	for _, blockTX := range block.Transactions {
+		if blockTX.isCoinBaseTX() {
+			continue
+		}
+		for _, input := range blockTX.TXInputs {
+			spentByBlock[string(utxoKey(input.TXID, input.Index))] = true
+		}
+	}
+
+	//已上链的交易和冲突的交易
+	var removed [][]byte
+	for _, blockTX := range block.Transactions {
+		removed = append(removed, blockTX.TXID)
+	}
+	err := bucket.ForEach(func(k, v []byte) error {
+		transaction := DeSerializeTransaction(v)
+		if transaction == nil {
+			return nil
+		}
+		for _, input := range transaction.TXInputs {
+			if spentByBlock[string(utxoKey(input.TXID, input.Index))] {
+				removed = append(removed, append([]byte{}, k...))
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, txid := range removed {
+		err := bucket.Delete(txid)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//MineBlock 从内存池按手续费率选择交易，与挖矿交易一起打包成新区块
+func (bc *BlockChain) MineBlock(mp *Mempool, miner string, data string) (*Block, error) {
+	lastHeight, err := bc.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	var txs []*Transaction
+	var fees Amount //区块中所有交易的手续费
+	err = bc.db.View(func(tx *bolt.Tx) error {
+		view, err := newUTXOView(tx)
+		if err != nil {
+			return err
+		}
+		prevBlock := getBlock(tx, bc.tail)
+		if prevBlock == nil {
+			return errors.New("读取最后一个区块失败")
+		}
+		size := 0
+		for _, entry := range mp.Entries() {
+			if size+entry.Size > maxBlockSize {
+				continue
+			}
+			//按区块内的顺序重新校验，跳过失效的交易
+			fee, err := validateTransaction(tx, view, entry.Tx)
+			if err == nil {
+				//未到锁定时间的交易留在内存池中等待
+				err = checkTransactionLocks(tx, view, entry.Tx, lastHeight+1, prevBlock)
+			}
+			if err != nil {
+				fmt.Printf("跳过交易%x: %v\n", entry.Tx.TXID, err)
+				continue
+			}
+			fees, err = AddAmount(fees, fee)
+			if err != nil {
+				return err
+			}
+			view.apply(entry.Tx)
+			txs = append(txs, entry.Tx)
+			size += entry.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//创建挖矿交易（奖励+手续费），放在交易集合的第一个
+	coinbase := NewCoinbaseTX(miner, data, lastHeight+1, fees)
+	txs = append([]*Transaction{coinbase}, txs...)
+
+	err = bc.AddBlock(txs)
+	if err != nil {
+		return nil, err
+	}
+	block, err := bc.GetBlock(bc.tail)
+	if err != nil {
+		return nil, err
+	}
+	mp.removeBlock(block)
+	return block, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+/*
+	梅克尔树：
+		叶子节点为交易ID，两两拼接后计算双重sha256得到父节点，节点数为奇数时复制最后一个节点，
+		直到只剩一个节点，即梅克尔根。
+		梅克尔路径（分支）为从叶子到根的每一层中兄弟节点的集合，
+		只需提供交易ID、其在区块中的位置和梅克尔路径，即可证明交易包含在区块中。
+*/
+
+//DoubleSha256 计算双重sha256
+func DoubleSha256(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+//hashMerkleNodes 拼接左右节点并计算父节点哈希
+func hashMerkleNodes(left []byte, right []byte) []byte {
+	data := make([]byte, 0, len(left)+len(right))
+	data = append(data, left...)
+	data = append(data, right...)
+	return DoubleSha256(data)
+}
+
+//nextMerkleLevel 由当前层节点计算上一层节点
+func nextMerkleLevel(level [][]byte) [][]byte {
+	var next [][]byte
+	for i := 0; i < len(level); i += 2 {
+		left := level[i]
+		right := left //节点数为奇数时复制最后一个节点
+		if i+1 < len(level) {
+			right = level[i+1]
+		}
+		next = append(next, hashMerkleNodes(left, right))
+	}
+	return next
+}
+
+//ComputeMerkleRoot 根据交易ID集合计算梅克尔根
+func ComputeMerkleRoot(txids [][]byte) []byte {
+	if len(txids) == 0 {
+		return nil
+	}
+	level := txids
+	for len(level) > 1 {
+		level = nextMerkleLevel(level)
+	}
+	return level[0]
+}
+
+//ComputeMerkleBranch 计算指定位置交易的梅克尔路径（从叶子到根的兄弟节点）
+func ComputeMerkleBranch(txids [][]byte, index int) [][]byte {
+	var branch [][]byte
+	level := txids
+	for len(level) > 1 {
+		//兄弟节点：偶数位置取右边节点，奇数位置取左边节点
+		sibling := index ^ 1
+		if sibling >= len(level) {
+			sibling = index
+		}
+		branch = append(branch, level[sibling])
+		level = nextMerkleLevel(level)
+		index /= 2
+	}
+	return branch
+}
+
+//VerifyMerkleBranch 根据交易ID、位置和梅克尔路径还原梅克尔根并与给定的根比较
+func VerifyMerkleBranch(txid []byte, index int64, branch [][]byte, merkleRoot []byte) bool {
+	if index < 0 {
+		return false
+	}
+	hash := txid
+	for _, sibling := range branch {
+		//位置的最低位决定当前节点在左还是右
+		if index&1 == 0 {
+			hash = hashMerkleNodes(hash, sibling)
+		} else {
+			hash = hashMerkleNodes(sibling, hash)
+		}
+		index >>= 1
+	}
+	//路径走完后位置应归零，否则路径长度与位置不匹配
+	return index == 0 && bytes.Equal(hash, merkleRoot)
+}
+
+//VerifyMerkleProof 校验梅克尔路径是否能证明交易包含在区块头对应的区块中
+func VerifyMerkleProof(txid []byte, index int64, branch [][]byte, header *Block) bool {
+	return VerifyMerkleBranch(txid, index, branch, header.MerkleRoot)
+}
+
+//txids 获取区块中所有交易的ID
+func (b *Block) txids() [][]byte {
+	var txids [][]byte
+	for _, tx := range b.Transactions {
+		txids = append(txids, tx.TXID)
+	}
+	return txids
+}
+
+//MerkleBranch 获取区块中指定交易的梅克尔路径及交易位置
+func (b *Block) MerkleBranch(txid []byte) ([][]byte, int64, error) {
+	for i, tx := range b.Transactions {
+		if bytes.Equal(tx.TXID, txid) {
+			return ComputeMerkleBranch(b.txids(), i), int64(i), nil
+		}
+	}
+	return nil, -1, errors.New("区块中没有该交易")
+}
+
+//MerkleProof 交易的梅克尔证明（以16进制字符串输出为JSON）
+type MerkleProof struct {
+	TXID       string   `json:"txid"`       //交易ID
+	BlockHash  string   `json:"blockhash"`  //所在区块的哈希值
+	Height     uint64   `json:"height"`     //所在区块的高度
+	MerkleRoot string   `json:"merkleroot"` //区块头中的梅克尔根
+	Index      int64    `json:"index"`      //交易在区块中的位置
+	Branch     []string `json:"branch"`     //梅克尔路径：从叶子到根的兄弟节点
+}
+
+//GetMerkleProof 根据交易ID生成梅克尔证明
+func (bc *BlockChain) GetMerkleProof(txid []byte) (*MerkleProof, error) {
+	_, location, err := bc.GetTransaction(txid)
+	if err != nil {
+		return nil, err
+	}
+	block, err := bc.GetBlock(location.BlockHash)
+	if err != nil {
+		return nil, err
+	}
+	branch, index, err := block.MerkleBranch(txid)
+	if err != nil {
+		return nil, err
+	}
+	//生成后自校验，防止区块中的梅克尔根不是由梅克尔树计算得到
+	if !VerifyMerkleProof(txid, index, branch, block) {
+		return nil, errors.New("区块梅克尔根与交易不匹配")
+	}
+
+	proof := MerkleProof{
+		TXID:       hex.EncodeToString(txid),
+		BlockHash:  hex.EncodeToString(block.Hash),
+		Height:     block.Height,
+		MerkleRoot: hex.EncodeToString(block.MerkleRoot),
+		Index:      index,
+		Branch:     []string{},
+	}
+	for _, node := range branch {
+		proof.Branch = append(proof.Branch, hex.EncodeToString(node))
+	}
+	return &proof, nil
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+/*
+	数据库迁移：
+		migratedb将旧格式的数据库转换为serialize.go中的当前格式，旧格式有两种：
+			gob格式（没有格式版本字段）     - 区块、UTXO和内存池交易使用gob编码
+			格式版本1（没有脚本的二进制格式）- input保存签名和公钥，output保存收款人的公钥哈希
+		转换步骤：
+			1. 区块和交易保留原来的版本、区块哈希和交易ID（gob格式的区块和交易标记为版本0），
+			   output的公钥哈希转换为P2PKH锁定脚本，input的签名和公钥转换为P2PKH解锁脚本，
+			   挖矿交易input中的区块高度和矿工数据直接作为解锁脚本
+			2. 区块哈希按区块版本重新计算并与记录的哈希比较，不一致时放弃迁移
+			3. UTXO集中的output同样转换为锁定脚本
+			4. 内存池中的旧版本交易不能再打包，直接清空，需要重新转账
+		交易索引和高度索引只保存哈希和位置，不需要转换。
+		所有修改在同一个数据库事务中完成，失败时数据库保持不变。
+*/
+
+//MigrateResult 数据库迁移的结果
+type MigrateResult struct {
+	Blocks         int //转换的区块个数
+	UTXOs          int //转换的utxo个数
+	MempoolDropped int //清空的内存池交易个数
+}
+
+//legacyTXInput 没有脚本的input（gob格式和格式版本1）
+type legacyTXInput struct {
+	TXID       []byte
+	Index      int64
+	ScriptSign []byte //签名
+	PubKey     []byte //公钥（挖矿交易为区块高度+矿工数据）
+}
+
+//legacyTXOutput 没有脚本的output（gob格式和格式版本1）
+type legacyTXOutput struct {
+	Value            Amount
+	ScriptPubKeyHash []byte //收款人的公钥哈希
+}
+
+//legacyTransaction 没有脚本的交易（gob格式和格式版本1）
+type legacyTransaction struct {
+	Version   uint32
+	TXID      []byte
+	TXInputs  []legacyTXInput
+	TXOutputs []legacyTXOutput
+	TimeStamp uint64
+}
+
+//legacyBlock 旧格式的区块（字段名与gob编码时的Block一致）
+type legacyBlock struct {
+	Version      uint64
+	Height       uint64
+	PrevHash     []byte
+	MerkleRoot   []byte
+	TimeStamp    uint64
+	Bits         uint64
+	Nonce        uint64
+	Hash         []byte
+	Transactions []*legacyTransaction
+}
+
+//MigrateDB 将旧格式的数据库转换为当前格式
+func MigrateDB(dbFile string) (*MigrateResult, error) {
+	if !IsFileExist(dbFile) {
+		return nil, errors.New("区块链文件不存在")
+	}
+	db, err := bolt.Open(dbFile, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var result MigrateResult
+	err = db.Update(func(tx *bolt.Tx) error {
+		blocks := tx.Bucket([]byte(blockBucket))
+		if blocks == nil {
+			return errors.New("No bucket")
+		}
+
+		//根据格式版本选择解码方式
+		var decodeBlock func([]byte) (*legacyBlock, error)
+		var decodeOutput func([]byte) (legacyTXOutput, error)
+		format := blocks.Get([]byte(dbFormatKey))
+		switch {
+		case format == nil:
+			decodeBlock, decodeOutput = gobDecodeLegacyBlock, gobDecodeLegacyOutput
+		case bytes.Equal(format, UintToByteSlice(1)):
+			decodeBlock, decodeOutput = decodeLegacyBlockV1, decodeLegacyOutputV1
+		case bytes.Equal(format, UintToByteSlice(dbFormatVersion)):
+			return errors.New("数据库已是当前格式，不需要转换")
+		default:
+			return errors.New("未知的数据库格式")
+		}
+
+		//区块（数据桶中除了区块，还有记录最后一个区块哈希和格式版本的字段）
+		converted := make(map[string][]byte)
+		err := blocks.ForEach(func(k, v []byte) error {
+			if string(k) == lastBlockHashKey || string(k) == dbFormatKey || string(k) == dbSchemeKey {
+				return nil
+			}
+			legacy, err := decodeBlock(v)
+			if err != nil {
+				return fmt.Errorf("区块%x: %v", k, err)
+			}
+			block, err := legacy.convert()
+			if err != nil {
+				return fmt.Errorf("区块%x: %v", k, err)
+			}
+			converted[string(k)] = block.Serialize()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for k, v := range converted {
+			err := blocks.Put([]byte(k), v)
+			if err != nil {
+				return err
+			}
+		}
+		result.Blocks = len(converted)
+
+		//UTXO集
+		if utxos := tx.Bucket([]byte(utxoBucket)); utxos != nil {
+			converted := make(map[string][]byte)
+			err := utxos.ForEach(func(k, v []byte) error {
+				legacy, err := decodeOutput(v)
+				if err != nil {
+					return err
+				}
+				converted[string(k)], err = serializeTXOutput(legacy.convert())
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			for k, v := range converted {
+				err := utxos.Put([]byte(k), v)
+				if err != nil {
+					return err
+				}
+			}
+			result.UTXOs = len(converted)
+		}
+
+		//内存池
+		if mempool := tx.Bucket([]byte(mempoolBucket)); mempool != nil {
+			result.MempoolDropped = mempool.Stats().KeyN
+			err := tx.DeleteBucket([]byte(mempoolBucket))
+			if err != nil {
+				return err
+			}
+		}
+		_, err = tx.CreateBucket([]byte(mempoolBucket))
+		if err != nil {
+			return err
+		}
+
+		//旧版本的数据库没有记录签名方案，使用的是P256
+		if blocks.Get([]byte(dbSchemeKey)) == nil {
+			err = blocks.Put([]byte(dbSchemeKey), []byte(SchemeP256))
+			if err != nil {
+				return err
+			}
+		}
+		return blocks.Put([]byte(dbFormatKey), UintToByteSlice(dbFormatVersion))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+//gobDecodeLegacyBlock 解码gob格式的区块，区块和交易标记为版本0
+func gobDecodeLegacyBlock(data []byte) (*legacyBlock, error) {
+	var block legacyBlock
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&block)
+	if err != nil {
+		return nil, err
+	}
+	block.Version = BlockVersionLegacy
+	for _, tx := range block.Transactions {
+		tx.Version = TxVersionLegacy
+	}
+	return &block, nil
+}
+
+//gobDecodeLegacyOutput 解码gob格式的output
+func gobDecodeLegacyOutput(data []byte) (legacyTXOutput, error) {
+	var output legacyTXOutput
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&output)
+	return output, err
+}
+
+//decodeLegacyOutputV1 解码格式版本1的output：int64 Value | bytes ScriptPubKeyHash
+func decodeLegacyOutputV1(data []byte) (legacyTXOutput, error) {
+	r := bytes.NewReader(data)
+	output, err := readLegacyOutputV1(r)
+	if err == nil {
+		err = checkTrailing(r)
+	}
+	return output, err
+}
+
+//readLegacyOutputV1 读取格式版本1的output
+func readLegacyOutputV1(r *bytes.Reader) (legacyTXOutput, error) {
+	var output legacyTXOutput
+	value, err := readUint64(r)
+	if err != nil {
+		return output, err
+	}
+	output.Value = Amount(value)
+	output.ScriptPubKeyHash, err = readVarBytes(r)
+	return output, err
+}
+
+//readLegacyInputV1 读取格式版本1的input：bytes TXID | int64 Index | bytes ScriptSign | bytes PubKey
+func readLegacyInputV1(r *bytes.Reader) (legacyTXInput, error) {
+	var input legacyTXInput
+	var err error
+	if input.TXID, err = readVarBytes(r); err != nil {
+		return input, err
+	}
+	index, err := readUint64(r)
+	if err != nil {
+		return input, err
+	}
+	input.Index = int64(index)
+	if input.ScriptSign, err = readVarBytes(r); err != nil {
+		return input, err
+	}
+	input.PubKey, err = readVarBytes(r)
+	return input, err
+}
+
+//readLegacyTransactionV1 读取格式版本1的交易（没有锁定时间）
+func readLegacyTransactionV1(r *bytes.Reader) (*legacyTransaction, error) {
+	var tx legacyTransaction
+	var err error
+	if tx.Version, err = readUint32(r); err != nil {
+		return nil, err
+	}
+	if tx.TXID, err = readVarBytes(r); err != nil {
+		return nil, err
+	}
+	inputCount, err := readCount(r, 11)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < inputCount; i++ {
+		input, err := readLegacyInputV1(r)
+		if err != nil {
+			return nil, err
+		}
+		tx.TXInputs = append(tx.TXInputs, input)
+	}
+	outputCount, err := readCount(r, 9)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < outputCount; i++ {
+		output, err := readLegacyOutputV1(r)
+		if err != nil {
+			return nil, err
+		}
+		tx.TXOutputs = append(tx.TXOutputs, output)
+	}
+	if tx.TimeStamp, err = readUint64(r); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+//decodeLegacyBlockV1 解码格式版本1的区块（区块头与当前格式相同，交易没有脚本）
+func decodeLegacyBlockV1(data []byte) (*legacyBlock, error) {
+	r := bytes.NewReader(data)
+	var b legacyBlock
+	var err error
+	if b.Version, err = readUint64(r); err != nil {
+		return nil, err
+	}
+	if b.PrevHash, err = readVarBytes(r); err != nil {
+		return nil, err
+	}
+	if b.MerkleRoot, err = readVarBytes(r); err != nil {
+		return nil, err
+	}
+	if b.TimeStamp, err = readUint64(r); err != nil {
+		return nil, err
+	}
+	if b.Bits, err = readUint64(r); err != nil {
+		return nil, err
+	}
+	if b.Nonce, err = readUint64(r); err != nil {
+		return nil, err
+	}
+	if b.Height, err = readUint64(r); err != nil {
+		return nil, err
+	}
+	if b.Hash, err = readVarBytes(r); err != nil {
+		return nil, err
+	}
+	count, err := readCount(r, 23)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < count; i++ {
+		tx, err := readLegacyTransactionV1(r)
+		if err != nil {
+			return nil, fmt.Errorf("交易%d: %w", i, err)
+		}
+		b.Transactions = append(b.Transactions, tx)
+	}
+	return &b, checkTrailing(r)
+}
+
+//convert 将公钥哈希转换为P2PKH锁定脚本
+func (output legacyTXOutput) convert() TXOutput {
+	return TXOutput{Value: output.Value, ScriptPubKey: NewP2PKHScript(output.ScriptPubKeyHash)}
+}
+
+//convert 将签名和公钥转换为P2PKH解锁脚本（挖矿交易的区块高度和矿工数据直接作为解锁脚本）
+func (input legacyTXInput) convert() TXInput {
+	scriptSig := input.PubKey
+	if input.TXID != nil || input.Index != -1 {
+		scriptSig = NewP2PKHScriptSig(input.ScriptSign, input.PubKey)
+	}
+	return TXInput{TXID: input.TXID, Index: input.Index, ScriptSig: scriptSig, Sequence: SequenceFinal}
+}
+
+//convert 转换为当前格式的区块并校验区块哈希
+func (lb *legacyBlock) convert() (*Block, error) {
+	block := Block{
+		Version:    lb.Version,
+		Height:     lb.Height,
+		PrevHash:   lb.PrevHash,
+		MerkleRoot: lb.MerkleRoot,
+		TimeStamp:  lb.TimeStamp,
+		Bits:       lb.Bits,
+		Nonce:      lb.Nonce,
+		Hash:       lb.Hash,
+	}
+	for _, ltx := range lb.Transactions {
+		tx := Transaction{Version: ltx.Version, TXID: ltx.TXID, TimeStamp: ltx.TimeStamp}
+		for _, input := range ltx.TXInputs {
+			tx.TXInputs = append(tx.TXInputs, input.convert())
+		}
+		for _, output := range ltx.TXOutputs {
+			tx.TXOutputs = append(tx.TXOutputs, output.convert())
+		}
+		block.Transactions = append(block.Transactions, &tx)
+	}
+
+	hash := sha256.Sum256(NewProofOfWork(&block).PrepareData(block.Nonce))
+	if !bytes.Equal(hash[:], block.Hash) {
+		return nil, ErrBlockBadHash
+	}
+	return &block, nil
+}
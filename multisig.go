@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+/*
+	多重签名钱包流程：
+		1. 每个参与者用getpubkey导出自己地址的公钥，
+		   用createmultisig <M> <公钥1,公钥2,...> 创建P2SH地址，赎回脚本保存到各自的wallet.dat（公钥顺序相同则地址相同）
+		2. 任意参与者用createmultisigtx从P2SH地址创建待签名的交易，写入文件，
+		   每个input的解锁脚本为待签名格式：OP_0 <公钥1的签名或空> ... <公钥N的签名或空> <赎回脚本>
+		3. 文件在参与者之间传递，每人用signmultisigtx为自己持有私钥的公钥填入签名
+		   （解锁脚本不参与交易ID和签名数据的计算，签名过程中交易ID不变）
+		4. 签名个数达到M后，sendmultisigtx去掉空位得到最终的解锁脚本 OP_0 <签名1> ... <签名M> <赎回脚本>，
+		   校验通过后放入内存池
+		交易文件的内容为交易序列化结果的十六进制字符串。
+*/
+
+//多重签名错误
+var (
+	ErrMultisigParams  = errors.New("多重签名的参数无效：需要1 <= M <= N <= 16，且赎回脚本不能超过520字节")
+	ErrMultisigUnknown = errors.New("钱包中没有该多重签名地址的赎回脚本，请先执行createmultisig")
+	ErrMultisigPartial = errors.New("input的解锁脚本不是待签名的多重签名格式")
+	ErrMultisigMissing = errors.New("签名个数不足")
+)
+
+//addMultisig 保存多重签名的赎回脚本，返回P2SH地址
+func (wm *WalletManager) addMultisig(redeemScript []byte) string {
+	address := ScriptAddress(redeemScript)
+	wm.Scripts[address] = redeemScript
+	if !wm.saveFile() {
+		return ""
+	}
+	return address
+}
+
+//listMultisig 获取所有保存了赎回脚本的多重签名地址
+func (wm *WalletManager) listMultisig() []string {
+	var addresses []string
+	for address := range wm.Scripts {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+//newPartialScriptSig 创建待签名的解锁脚本：OP_0 <每个公钥对应的签名或空> <赎回脚本>
+func newPartialScriptSig(sigs [][]byte, redeemScript []byte) []byte {
+	scriptSig := []byte{OP_0}
+	for _, sig := range sigs {
+		scriptSig = append(scriptSig, pushData(sig)...)
+	}
+	return append(scriptSig, pushData(redeemScript)...)
+}
+
+//parsePartialScriptSig 解析待签名的解锁脚本，返回每个公钥对应的签名（空表示未签名）和赎回脚本
+func parsePartialScriptSig(scriptSig []byte) ([][]byte, []byte, error) {
+	ops, err := parseScript(scriptSig)
+	if err != nil || len(ops) < 2 || ops[0].opcode != OP_0 {
+		return nil, nil, ErrMultisigPartial
+	}
+	redeemScript := ops[len(ops)-1].data
+	_, pubKeys, ok := parseMultisigScript(redeemScript)
+	if !ok || len(ops) != len(pubKeys)+2 {
+		return nil, nil, ErrMultisigPartial
+	}
+	var sigs [][]byte
+	for _, op := range ops[1 : len(ops)-1] {
+		if op.opcode > OP_PUSHDATA4 {
+			return nil, nil, ErrMultisigPartial
+		}
+		sigs = append(sigs, op.data)
+	}
+	return sigs, redeemScript, nil
+}
+
+//NewMultisigTransaction 创建从多重签名地址付款的待签名交易，找零给from
+//from - P2SH地址（赎回脚本需已保存在钱包中），payments - 收款人及金额，fee - 手续费，selector - 选币策略
+func NewMultisigTransaction(from string, payments []Payment, fee Amount, selector CoinSelector, bc *BlockChain) *Transaction {
+	wm := NewWalletManager()
+	if wm == nil {
+		fmt.Println("打开钱包失败")
+		return nil
+	}
+	redeemScript, ok := wm.Scripts[from]
+	if !ok {
+		fmt.Println(ErrMultisigUnknown)
+		return nil
+	}
+	_, pubKeys, _ := parseMultisigScript(redeemScript)
+
+	needed, ok := sumPayments(payments, fee)
+	if !ok {
+		return nil
+	}
+	utxoInfos, retValue, err := bc.findNeedUTXO(NewP2SHScript(scriptHash(redeemScript)), needed, selector)
+	if err != nil {
+		fmt.Printf("%v，创建交易失败\n", err)
+		return nil
+	}
+
+	//每个input的解锁脚本为空的待签名格式
+	var inputs []TXInput
+	for _, utxoInfo := range utxoInfos {
+		input := TXInput{
+			TXID:      utxoInfo.TXID,
+			Index:     utxoInfo.Index,
+			ScriptSig: newPartialScriptSig(make([][]byte, len(pubKeys)), redeemScript),
+			Sequence:  SequenceFinal,
+		}
+		inputs = append(inputs, input)
+	}
+	return newUnsignedTransaction(inputs, retValue, payments, needed, from, TxLock{})
+}
+
+//SignMultisig 使用钱包中的私钥为待签名交易填入签名，返回新增的签名个数
+//签名数据只依赖交易本身和赎回脚本，不需要查询引用的交易
+func (tx *Transaction) SignMultisig(wm *WalletManager) (int, error) {
+	added := 0
+	for i, input := range tx.TXInputs {
+		sigs, redeemScript, err := parsePartialScriptSig(input.ScriptSig)
+		if err != nil {
+			return added, fmt.Errorf("input %d: %w", i, err)
+		}
+		_, pubKeys, _ := parseMultisigScript(redeemScript)
+		for j, pubKey := range pubKeys {
+			if len(sigs[j]) != 0 {
+				continue
+			}
+			wallet, ok := wm.Wallets[encodeAddress(pubKeyHashAddrID, GetPubKeyHashFromPublicKey(pubKey))]
+			if !ok || wallet.Scheme != activeNetParams.Scheme.Name() {
+				continue
+			}
+			if wallet.PrivateKey == nil {
+				return added, ErrWalletLocked
+			}
+			sig, err := activeNetParams.Scheme.Sign(wallet.PrivateKey, tx.signatureHash(i, redeemScript))
+			if err != nil {
+				return added, err
+			}
+			sigs[j] = sig
+			added++
+		}
+		tx.TXInputs[i].ScriptSig = newPartialScriptSig(sigs, redeemScript)
+	}
+	return added, nil
+}
+
+//multisigProgress 统计每个input已有的签名个数和需要的签名个数
+func (tx *Transaction) multisigProgress() ([]string, error) {
+	var lines []string
+	for i, input := range tx.TXInputs {
+		sigs, redeemScript, err := parsePartialScriptSig(input.ScriptSig)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+		required, _, _ := parseMultisigScript(redeemScript)
+		count := 0
+		for _, sig := range sigs {
+			if len(sig) != 0 {
+				count++
+			}
+		}
+		lines = append(lines, fmt.Sprintf("input %d: %d/%d", i, count, required))
+	}
+	return lines, nil
+}
+
+//FinalizeMultisig 签名个数足够时，将待签名格式转换为最终的解锁脚本：OP_0 <前M个签名> <赎回脚本>
+func (tx *Transaction) FinalizeMultisig() error {
+	for i, input := range tx.TXInputs {
+		sigs, redeemScript, err := parsePartialScriptSig(input.ScriptSig)
+		if err != nil {
+			return fmt.Errorf("input %d: %w", i, err)
+		}
+		required, _, _ := parseMultisigScript(redeemScript)
+		var present [][]byte
+		for _, sig := range sigs {
+			if len(sig) != 0 && len(present) < required {
+				present = append(present, sig)
+			}
+		}
+		if len(present) < required {
+			return fmt.Errorf("input %d: %w（%d/%d）", i, ErrMultisigMissing, len(present), required)
+		}
+		tx.TXInputs[i].ScriptSig = newPartialScriptSig(present, redeemScript)
+	}
+	return nil
+}
+
+//writeTransactionFile 将交易以十六进制写入文件
+func writeTransactionFile(file string, tx *Transaction) error {
+	return ioutil.WriteFile(file, []byte(hex.EncodeToString(tx.Serialize())+"\n"), 0600)
+}
+
+//readTransactionFile 从文件读取十六进制的交易
+func readTransactionFile(file string) (*Transaction, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(data)
+	tx, err := decodeTransaction(r)
+	if err == nil {
+		err = checkTrailing(r)
+	}
+	return tx, err
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+/*
+	网络参数：
+		不同网络使用不同的难度上限、难度调整周期和期望出块时间，
+		测试网络可以快速挖矿，预发布网络保持与主网一致的节奏。
+		区块奖励和减半周期、钱包和交易使用的签名方案也由网络参数决定。
+		通过环境变量BLOCKCHAIN_NET选择网络（mainnet、testnet、regtest），默认为mainnet。
+		签名方案是共识规则的一部分，创建区块链时记录在数据库中（见blockchain.go的dbSchemeKey），
+		之后总是使用数据库记录的签名方案：由最初的P256链迁移的数据库记录为p256。
+		新建区块链默认使用secp256k1，环境变量BLOCKCHAIN_SCHEME可以选择其他签名方案（secp256k1、p256），
+		已有数据库时环境变量必须与数据库记录的签名方案一致。
+*/
+
+//选择网络和签名方案的环境变量
+const (
+	networkEnv = "BLOCKCHAIN_NET"
+	schemeEnv  = "BLOCKCHAIN_SCHEME"
+)
+
+//NetParams 网络参数
+type NetParams struct {
+	Name             string        //网络名称
+	DBFile           string        //区块链数据库文件
+	PowLimitBits     uint64        //最低难度（最大目标值）的压缩格式，创世块使用该难度
+	RetargetInterval uint64        //每隔多少个区块调整一次难度
+	TargetBlockTime  time.Duration //期望的出块时间
+	NoRetargeting    bool          //是否关闭难度调整（始终使用最低难度）
+
+	InitialSubsidy         Amount //创世块的区块奖励
+	SubsidyHalvingInterval uint64 //每隔多少个区块奖励减半
+
+	Scheme       SignatureScheme //签名方案（曲线）
+	HDCoinType   uint32          //HD钱包派生路径中的币种（BIP44，见hd.go）
+	PrivateKeyID byte            //WIF私钥的版本（见wif.go）
+}
+
+//MainNetParams 主网参数
+var MainNetParams = NetParams{
+	Name:             "mainnet",
+	DBFile:           "blockchain.db",
+	PowLimitBits:     0x1f010000, //目标值0x0001000...（与最初写死的目标值一致）
+	RetargetInterval: 2016,
+	TargetBlockTime:  10 * time.Minute,
+
+	InitialSubsidy:         12*CoinUnit + CoinUnit/2,
+	SubsidyHalvingInterval: 210000,
+
+	Scheme:       secp256k1Scheme{},
+	HDCoinType:   0,
+	PrivateKeyID: 0x80,
+}
+
+//TestNetParams 测试网参数：难度上限与主网一致，调整周期和出块时间更短
+var TestNetParams = NetParams{
+	Name:             "testnet",
+	DBFile:           "blockchain_testnet.db",
+	PowLimitBits:     0x1f010000,
+	RetargetInterval: 20,
+	TargetBlockTime:  30 * time.Second,
+
+	InitialSubsidy:         12*CoinUnit + CoinUnit/2,
+	SubsidyHalvingInterval: 210000,
+
+	Scheme:       secp256k1Scheme{},
+	HDCoinType:   1,
+	PrivateKeyID: 0xef,
+}
+
+//RegTestParams 本地回归测试网参数：极低难度且不调整，可以瞬间出块
+var RegTestParams = NetParams{
+	Name:             "regtest",
+	DBFile:           "blockchain_regtest.db",
+	PowLimitBits:     0x207fffff,
+	RetargetInterval: 10,
+	TargetBlockTime:  time.Second,
+	NoRetargeting:    true,
+
+	InitialSubsidy:         12*CoinUnit + CoinUnit/2,
+	SubsidyHalvingInterval: 150,
+
+	Scheme:       secp256k1Scheme{},
+	HDCoinType:   1,
+	PrivateKeyID: 0xef,
+}
+
+//当前使用的网络参数
+var activeNetParams = &MainNetParams
+
+//SelectNetwork 根据名称选择网络，名称为空时使用主网
+func SelectNetwork(name string) error {
+	switch name {
+	case "", MainNetParams.Name:
+		activeNetParams = &MainNetParams
+	case TestNetParams.Name:
+		activeNetParams = &TestNetParams
+	case RegTestParams.Name:
+		activeNetParams = &RegTestParams
+	default:
+		return errors.New("未知的网络: " + name)
+	}
+	return nil
+}
+
+//SelectScheme 选择签名方案：已有区块链数据库时使用数据库记录的签名方案，name不为空时必须与之一致；
+//没有数据库时name为空使用网络默认的签名方案
+func SelectScheme(name string) error {
+	stored, err := ReadDBScheme(activeNetParams.DBFile)
+	if err != nil {
+		return err
+	}
+	if stored != "" {
+		if name != "" && name != stored {
+			return fmt.Errorf("区块链数据库%s使用%s签名方案，与%s=%s不一致", activeNetParams.DBFile, stored, schemeEnv, name)
+		}
+		name = stored
+	}
+	if name == "" || name == activeNetParams.Scheme.Name() {
+		return nil
+	}
+	scheme, err := GetSignatureScheme(name)
+	if err != nil {
+		return err
+	}
+	//复制网络参数，不修改网络的默认参数
+	params := *activeNetParams
+	params.Scheme = scheme
+	activeNetParams = &params
+	return nil
+}
+
+//SelectNetworkFromEnv 根据环境变量选择网络和签名方案
+func SelectNetworkFromEnv() error {
+	err := SelectNetwork(os.Getenv(networkEnv))
+	if err != nil {
+		return err
+	}
+	return SelectScheme(os.Getenv(schemeEnv))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+)
+
+/*
+	文件存证：
+		notarize计算文件的sha256哈希，放入一笔普通交易的数据output（OP_RETURN <32字节哈希>），
+		交易上链后，区块的时间戳证明文件在该时间之前已经存在，且内容没有被修改。
+		verifynotary重新计算文件哈希，遍历账本查找包含该哈希的数据output，
+		同一个哈希被多次存证时以最早的区块为准；只在内存池中找到时表示尚未上链。
+*/
+
+//存证错误
+var ErrNotaryNotFound = errors.New("没有找到包含该文件哈希的交易")
+
+//NotaryRecord 文件哈希所在的交易和区块
+type NotaryRecord struct {
+	Tx    *Transaction //包含数据output的交易
+	Block *Block       //交易所在的区块（为nil时交易在内存池中，尚未上链）
+}
+
+//fileDigest 计算文件内容的sha256哈希
+func fileDigest(file string) ([]byte, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(content)
+	return hash[:], nil
+}
+
+//NewNotaryTransaction 创建存证交易：一个数据output保存digest，付款人的utxo扣除手续费后全部找零给自己
+func NewNotaryTransaction(from string, digest []byte, fee Amount, selector CoinSelector, bc *BlockChain) *Transaction {
+	return NewTransactionMany(from, []Payment{{Data: digest}}, fee, selector, TxLock{}, bc)
+}
+
+//hasNullData 判断交易是否有保存data的数据output
+func (tx *Transaction) hasNullData(data []byte) bool {
+	for _, output := range tx.TXOutputs {
+		if found, ok := extractNullData(output.ScriptPubKey); ok && bytes.Equal(found, data) {
+			return true
+		}
+	}
+	return false
+}
+
+//FindNotary 查找保存digest的交易：先遍历账本（取最早的区块），没有时再查询内存池
+func (bc *BlockChain) FindNotary(digest []byte) (*NotaryRecord, error) {
+	var record *NotaryRecord
+
+	//从最后一个区块向前遍历，后找到的更早
+	it := bc.NewIterator()
+	for {
+		block := it.Next()
+		if block == nil {
+			return nil, errors.New("读取区块失败")
+		}
+		for _, tx := range block.Transactions {
+			if tx.hasNullData(digest) {
+				record = &NotaryRecord{tx, block}
+				break
+			}
+		}
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+	if record != nil {
+		return record, nil
+	}
+
+	mp, err := bc.LoadMempool()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range mp.Entries() {
+		if entry.Tx.hasNullData(digest) {
+			return &NotaryRecord{entry.Tx, nil}, nil
+		}
+	}
+	return nil, ErrNotaryNotFound
+}
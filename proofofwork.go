@@ -13,17 +13,18 @@ type ProofOfWork struct {
 	target *big.Int //目标值(大数值类型)：与生成的哈希值比较
 }
 
-//NewProofOfWork 创建一个工作证明(用户提供区块）系统提供目标值
+//NewProofOfWork 创建一个工作证明(用户提供区块）目标值由区块的Bits字段决定
 func NewProofOfWork(block *Block) *ProofOfWork {
 	pow := ProofOfWork{
 		block: block,
 	}
-	//难度值：
-	targetStr := "0001000000000000000000000000000000000000000000000000000000000000"
-	//目标值(64位的16进制数)：
-	tmpBigInt := new(big.Int)          //创建一个BigInt
-	tmpBigInt.SetString(targetStr, 16) //将难度值字符串以16进制赋值给BigInt
-	pow.target = tmpBigInt
+	//难度值：旧版本区块的Bits为0，使用最初写死的难度
+	bits := block.Bits
+	if bits == 0 {
+		bits = legacyBits
+	}
+	//目标值：将压缩格式的难度还原为BigInt
+	pow.target = CompactToBig(bits)
 
 	return &pow
 }
@@ -61,9 +62,14 @@ func (pow *ProofOfWork) Run() ([]byte, uint64) {
 	return hash[:], nonce
 }
 
-//PrepareData 拼接Nonce和区块数据
+//PrepareData 拼接Nonce和区块数据：当前版本的区块使用序列化的区块头
 func (pow *ProofOfWork) PrepareData(nonce uint64) []byte {
 	b := pow.block
+	if b.Version != BlockVersionLegacy {
+		return b.serializeHeader(nonce)
+	}
+
+	//旧版本区块：直接拼接各个字段，没有长度前缀
 	//将区块各个字段的字节流进行拼接
 	tmp := [][]byte{
 		UintToByteSlice(b.Version),
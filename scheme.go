@@ -0,0 +1,230 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secpecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+/*
+	签名方案：
+		密钥生成、签名、校验和公钥编码由签名方案统一提供，每个网络使用一种签名方案（见network.go）。
+			secp256k1 - 与比特币相同的曲线，签名为RFC6979确定性签名
+			p256      - 最初使用的NIST P-256曲线，签名同样为RFC6979确定性签名，
+			            兼容最初钱包的X||Y公钥（64字节，没有前缀），用于转出旧格式地址上的资金
+		私钥为32字节的大端整数，公钥为SEC1编码，签名为s较小的DER编码（见signature.go）。
+		交易input中的公钥按当前网络的签名方案解析和校验。
+*/
+
+//签名方案名称
+const (
+	SchemeSecp256k1 = "secp256k1"
+	SchemeP256      = "p256"
+)
+
+//签名方案错误
+var (
+	ErrPriKeyInvalid = errors.New("私钥无效")
+	ErrSigInvalid    = errors.New("签名校验失败")
+	ErrUnknownScheme = errors.New("未知的签名方案")
+)
+
+//SignatureScheme 签名方案
+type SignatureScheme interface {
+	//Name 签名方案名称
+	Name() string
+	//GenerateKey 生成私钥
+	GenerateKey() ([]byte, error)
+	//PublicKey 由私钥计算SEC1编码的公钥（compressed为true时使用压缩格式）
+	PublicKey(priKey []byte, compressed bool) ([]byte, error)
+	//Sign 对哈希签名，返回DER编码的签名
+	Sign(priKey []byte, hash []byte) ([]byte, error)
+	//Verify 校验签名，公钥和签名必须是规范的编码
+	Verify(pubKey []byte, hash []byte, sig []byte) error
+	//CheckPublicKey 检查公钥是否为有效的SEC1编码且在曲线上
+	CheckPublicKey(pubKey []byte) error
+}
+
+//GetSignatureScheme 根据名称获取签名方案
+func GetSignatureScheme(name string) (SignatureScheme, error) {
+	switch name {
+	case SchemeSecp256k1:
+		return secp256k1Scheme{}, nil
+	case SchemeP256:
+		return p256Scheme{}, nil
+	default:
+		return nil, ErrUnknownScheme
+	}
+}
+
+//secp256k1Scheme secp256k1曲线
+type secp256k1Scheme struct{}
+
+//Name 实现SignatureScheme
+func (secp256k1Scheme) Name() string {
+	return SchemeSecp256k1
+}
+
+//GenerateKey 实现SignatureScheme
+func (secp256k1Scheme) GenerateKey() ([]byte, error) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return key.Serialize(), nil
+}
+
+//parsePrivateKey 解析私钥，必须为32字节且在1到N-1之间
+func (secp256k1Scheme) parsePrivateKey(priKey []byte) (*secp256k1.PrivateKey, error) {
+	var d secp256k1.ModNScalar
+	if len(priKey) != 32 || d.SetByteSlice(priKey) || d.IsZero() {
+		return nil, ErrPriKeyInvalid
+	}
+	return secp256k1.NewPrivateKey(&d), nil
+}
+
+//PublicKey 实现SignatureScheme
+func (s secp256k1Scheme) PublicKey(priKey []byte, compressed bool) ([]byte, error) {
+	key, err := s.parsePrivateKey(priKey)
+	if err != nil {
+		return nil, err
+	}
+	if compressed {
+		return key.PubKey().SerializeCompressed(), nil
+	}
+	return key.PubKey().SerializeUncompressed(), nil
+}
+
+//Sign 实现SignatureScheme
+func (s secp256k1Scheme) Sign(priKey []byte, hash []byte) ([]byte, error) {
+	key, err := s.parsePrivateKey(priKey)
+	if err != nil {
+		return nil, err
+	}
+	//RFC6979确定性签名，s已规范为较小的值
+	return secpecdsa.Sign(key, hash).Serialize(), nil
+}
+
+//parsePublicKey 解析公钥：只接受压缩和未压缩格式（不接受混合格式）
+func (secp256k1Scheme) parsePublicKey(pubKey []byte) (*secp256k1.PublicKey, error) {
+	if len(pubKey) == 0 || (pubKey[0] != pubKeyCompressedEven && pubKey[0] != pubKeyCompressedOdd && pubKey[0] != pubKeyUncompressed) {
+		return nil, ErrPubKeyFormat
+	}
+	key, err := secp256k1.ParsePubKey(pubKey)
+	if err != nil {
+		return nil, ErrPubKeyCurve
+	}
+	return key, nil
+}
+
+//CheckPublicKey 实现SignatureScheme
+func (s secp256k1Scheme) CheckPublicKey(pubKey []byte) error {
+	_, err := s.parsePublicKey(pubKey)
+	return err
+}
+
+//Verify 实现SignatureScheme
+func (s secp256k1Scheme) Verify(pubKey []byte, hash []byte, sig []byte) error {
+	key, err := s.parsePublicKey(pubKey)
+	if err != nil {
+		return err
+	}
+	//严格解析DER编码的签名：不规范的编码返回ErrSigDER，较大的s值返回ErrSigHighS
+	if _, _, err := parseSignatureDER(secp256k1.S256(), sig); err != nil {
+		return err
+	}
+	signature, err := secpecdsa.ParseDERSignature(sig)
+	if err != nil {
+		return ErrSigDER
+	}
+	if !signature.Verify(hash, key) {
+		return ErrSigInvalid
+	}
+	return nil
+}
+
+//p256Scheme NIST P-256曲线
+type p256Scheme struct{}
+
+//Name 实现SignatureScheme
+func (p256Scheme) Name() string {
+	return SchemeP256
+}
+
+//GenerateKey 实现SignatureScheme
+func (p256Scheme) GenerateKey() ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return paddedBytes(key.D, 32), nil
+}
+
+//parsePrivateKey 解析私钥，必须为32字节且在1到N-1之间
+func (p256Scheme) parsePrivateKey(priKey []byte) (*ecdsa.PrivateKey, error) {
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(priKey)
+	if len(priKey) != 32 || d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, ErrPriKeyInvalid
+	}
+	key := ecdsa.PrivateKey{D: d}
+	key.Curve = curve
+	key.X, key.Y = curve.ScalarBaseMult(priKey)
+	return &key, nil
+}
+
+//PublicKey 实现SignatureScheme
+func (s p256Scheme) PublicKey(priKey []byte, compressed bool) ([]byte, error) {
+	key, err := s.parsePrivateKey(priKey)
+	if err != nil {
+		return nil, err
+	}
+	return encodePublicKey(&key.PublicKey, compressed), nil
+}
+
+//Sign 实现SignatureScheme
+func (s p256Scheme) Sign(priKey []byte, hash []byte) ([]byte, error) {
+	key, err := s.parsePrivateKey(priKey)
+	if err != nil {
+		return nil, err
+	}
+	return signLowS(key, hash)
+}
+
+//parsePublicKey 解析SEC1编码的公钥，或最初钱包使用的X||Y公钥
+func (p256Scheme) parsePublicKey(pubKey []byte) (*ecdsa.PublicKey, error) {
+	curve := elliptic.P256()
+	if len(pubKey) == 2*curveByteSize(curve) {
+		pubKey = append([]byte{pubKeyUncompressed}, pubKey...)
+	}
+	return parsePublicKey(curve, pubKey)
+}
+
+//CheckPublicKey 实现SignatureScheme
+func (s p256Scheme) CheckPublicKey(pubKey []byte) error {
+	_, err := s.parsePublicKey(pubKey)
+	return err
+}
+
+//Verify 实现SignatureScheme
+func (p256Scheme) Verify(pubKey []byte, hash []byte, sig []byte) error {
+	//严格解析DER编码的签名，拒绝不规范的编码和较大的s值
+	r, s, err := parseSignatureDER(elliptic.P256(), sig)
+	if err != nil {
+		return err
+	}
+	//还原公钥本身（SEC1编码或X||Y）
+	key, err := p256Scheme{}.parsePublicKey(pubKey)
+	if err != nil {
+		return err
+	}
+	if !ecdsa.Verify(key, hash, r, s) {
+		return ErrSigInvalid
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+//hexInt 解析十六进制的整数
+func hexInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+	v, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("整数格式错误: %s", s)
+	}
+	return v
+}
+
+//pubKeyVector 私钥对应的公钥
+type pubKeyVector struct {
+	priKey       string
+	compressed   string
+	uncompressed string
+}
+
+//sigVector RFC6979签名：r和s为s规范为较小的值之前的结果
+type sigVector struct {
+	priKey  string
+	message string
+	r, s    string
+}
+
+//schemeVectors 每个签名方案的已知答案
+var schemeVectors = []struct {
+	scheme  SignatureScheme
+	curve   elliptic.Curve
+	pubKeys []pubKeyVector
+	sigs    []sigVector
+}{
+	{
+		scheme: secp256k1Scheme{},
+		curve:  secp256k1.S256(),
+		pubKeys: []pubKeyVector{
+			{
+				"0000000000000000000000000000000000000000000000000000000000000001",
+				"0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+				"0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8",
+			},
+		},
+		sigs: []sigVector{
+			{
+				"0000000000000000000000000000000000000000000000000000000000000001",
+				"Satoshi Nakamoto",
+				"934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d8",
+				"2442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5",
+			},
+			{
+				"0000000000000000000000000000000000000000000000000000000000000001",
+				"All those moments will be lost in time, like tears in rain. Time to die...",
+				"8600dbd41e348fe5c9465ab92d23e3db8b98b873beecd930736488696438cb6b",
+				"547fe64427496db33bf66019dacbf0039c04199abb0122918601db38a72cfc21",
+			},
+		},
+	},
+	{
+		//RFC6979 A.2.5
+		scheme: p256Scheme{},
+		curve:  elliptic.P256(),
+		pubKeys: []pubKeyVector{
+			{
+				"0000000000000000000000000000000000000000000000000000000000000001",
+				"036b17d1f2e12c4247f8bce6e563a440f277037d812deb33a0f4a13945d898c296",
+				"046b17d1f2e12c4247f8bce6e563a440f277037d812deb33a0f4a13945d898c2964fe342e2fe1a7f9b8ee7eb4a7c0f9e162bce33576b315ececbb6406837bf51f5",
+			},
+			{
+				"c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721",
+				"0360fed4ba255a9d31c961eb74c6356d68c049b8923b61fa6ce669622e60f29fb6",
+				"0460fed4ba255a9d31c961eb74c6356d68c049b8923b61fa6ce669622e60f29fb67903fe1008b8bc99a41ae9e95628bc64f2f1b20c2d7e9f5177a3c294d4462299",
+			},
+		},
+		sigs: []sigVector{
+			{
+				"c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721",
+				"sample",
+				"efd48b2aacb6a8fd1140dd9cd45e81d69d2c877b56aaf991c34d0ea84eaf3716",
+				"f7cb1c942d657c41d436c7a1b6e29f65f3e900dbb9aff4064dc4ab2f843acda8",
+			},
+			{
+				"c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721",
+				"test",
+				"f1abb023518351cd71d881567b1ea663ed3efcf6c5132b354f28d3b0b7d38367",
+				"019f4113742a2b14bd25926b49c649155f267e60d3814b4c0cc84250e46f0083",
+			},
+		},
+	},
+}
+
+//TestSchemePublicKey 私钥计算压缩和未压缩格式的公钥
+func TestSchemePublicKey(t *testing.T) {
+	for _, sv := range schemeVectors {
+		for _, v := range sv.pubKeys {
+			priKey := mustHex(t, v.priKey)
+			for _, c := range []struct {
+				compressed bool
+				want       string
+			}{{true, v.compressed}, {false, v.uncompressed}} {
+				pubKey, err := sv.scheme.PublicKey(priKey, c.compressed)
+				if err != nil {
+					t.Fatalf("%s: %v", sv.scheme.Name(), err)
+				}
+				if hex.EncodeToString(pubKey) != c.want {
+					t.Errorf("%s: 私钥%s的公钥为%x，期望%s", sv.scheme.Name(), v.priKey, pubKey, c.want)
+				}
+				if err := sv.scheme.CheckPublicKey(pubKey); err != nil {
+					t.Errorf("%s: 公钥%x无效: %v", sv.scheme.Name(), pubKey, err)
+				}
+			}
+		}
+		//私钥为0或不小于N时无效
+		for _, priKey := range [][]byte{make([]byte, 32), paddedBytes(sv.curve.Params().N, 32), make([]byte, 31)} {
+			if _, err := sv.scheme.PublicKey(priKey, true); err != ErrPriKeyInvalid {
+				t.Errorf("%s: 私钥%x的错误为%v", sv.scheme.Name(), priKey, err)
+			}
+		}
+	}
+}
+
+//TestSchemeSign RFC6979确定性签名与已知答案一致，s规范为较小的值，签名可以通过校验
+func TestSchemeSign(t *testing.T) {
+	for _, sv := range schemeVectors {
+		n := sv.curve.Params().N
+		for _, v := range sv.sigs {
+			priKey := mustHex(t, v.priKey)
+			pubKey, err := sv.scheme.PublicKey(priKey, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash := sha256.Sum256([]byte(v.message))
+			sig, err := sv.scheme.Sign(priKey, hash[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, s := hexInt(t, v.r), hexInt(t, v.s)
+			if !isLowS(n, s) {
+				s.Sub(n, s)
+			}
+			want := encodeSignatureDER(r, s)
+			if hex.EncodeToString(sig) != hex.EncodeToString(want) {
+				t.Errorf("%s: 对%q的签名为%x，期望%x", sv.scheme.Name(), v.message, sig, want)
+			}
+			//相同的私钥和哈希得到相同的签名
+			again, _ := sv.scheme.Sign(priKey, hash[:])
+			if hex.EncodeToString(again) != hex.EncodeToString(sig) {
+				t.Errorf("%s: 签名不是确定性的", sv.scheme.Name())
+			}
+			if err := sv.scheme.Verify(pubKey, hash[:], sig); err != nil {
+				t.Errorf("%s: 签名校验失败: %v", sv.scheme.Name(), err)
+			}
+			other := sha256.Sum256([]byte(v.message + "!"))
+			if err := sv.scheme.Verify(pubKey, other[:], sig); err != ErrSigInvalid {
+				t.Errorf("%s: 哈希不同时的错误为%v", sv.scheme.Name(), err)
+			}
+		}
+	}
+}
+
+//TestSchemeVerifyEncoding 较大的s值返回ErrSigHighS，不规范的DER编码返回ErrSigDER
+func TestSchemeVerifyEncoding(t *testing.T) {
+	for _, sv := range schemeVectors {
+		n := sv.curve.Params().N
+		v := sv.sigs[0]
+		priKey := mustHex(t, v.priKey)
+		pubKey, _ := sv.scheme.PublicKey(priKey, false)
+		hash := sha256.Sum256([]byte(v.message))
+		sig, _ := sv.scheme.Sign(priKey, hash[:])
+
+		//DER编码解析后重新编码得到相同的签名
+		r, s, err := parseSignatureDER(sv.curve, sig)
+		if err != nil {
+			t.Fatalf("%s: %v", sv.scheme.Name(), err)
+		}
+		if hex.EncodeToString(encodeSignatureDER(r, s)) != hex.EncodeToString(sig) {
+			t.Errorf("%s: DER编码解析后重新编码的结果不同", sv.scheme.Name())
+		}
+
+		//s替换为N-s：同样满足签名方程，但必须被拒绝
+		highS := encodeSignatureDER(r, new(big.Int).Sub(n, s))
+		if err := sv.scheme.Verify(pubKey, hash[:], highS); err != ErrSigHighS {
+			t.Errorf("%s: s较大的签名的错误为%v", sv.scheme.Name(), err)
+		}
+
+		//r前面多一个0（多余的前导0）
+		rb := append([]byte{0x00}, derInteger(r)...)
+		sb := derInteger(s)
+		padded := append([]byte{0x30, byte(4 + len(rb) + len(sb)), 0x02, byte(len(rb))}, rb...)
+		padded = append(append(padded, 0x02, byte(len(sb))), sb...)
+		//总长度与实际长度不一致
+		badLength := append([]byte{}, sig...)
+		badLength[1]++
+		//末尾有多余的字节
+		trailing := append(append([]byte{}, sig...), 0x00)
+		trailing[1]++
+		for _, bad := range [][]byte{padded, badLength, trailing, sig[:len(sig)-1], nil} {
+			if err := sv.scheme.Verify(pubKey, hash[:], bad); err != ErrSigDER {
+				t.Errorf("%s: 不规范的编码%x的错误为%v", sv.scheme.Name(), bad, err)
+			}
+		}
+	}
+}
+
+//TestSchemeCheckPublicKey 拒绝格式错误和不在曲线上的公钥
+func TestSchemeCheckPublicKey(t *testing.T) {
+	for _, sv := range schemeVectors {
+		v := sv.pubKeys[0]
+		compressed := mustHex(t, v.compressed)
+		uncompressed := mustHex(t, v.uncompressed)
+
+		//Y加1后不在曲线上
+		offCurve := append([]byte{}, uncompressed...)
+		offCurve[len(offCurve)-1]++
+		//混合格式（0x06、0x07）不被接受
+		hybrid := append([]byte{}, uncompressed...)
+		hybrid[0] = 0x06
+		//errs为可以接受的错误（secp256k1的长度错误由曲线库报告为不在曲线上）
+		cases := []struct {
+			pubKey []byte
+			errs   []error
+		}{
+			{nil, []error{ErrPubKeyFormat}},
+			{compressed[:32], []error{ErrPubKeyFormat, ErrPubKeyCurve}},
+			{append([]byte{0x05}, compressed[1:]...), []error{ErrPubKeyFormat}},
+			{hybrid, []error{ErrPubKeyFormat}},
+			{offCurve, []error{ErrPubKeyCurve}},
+		}
+		for _, c := range cases {
+			err := sv.scheme.CheckPublicKey(c.pubKey)
+			accepted := false
+			for _, want := range c.errs {
+				accepted = accepted || err == want
+			}
+			if !accepted {
+				t.Errorf("%s: 公钥%x的错误为%v，期望%v", sv.scheme.Name(), c.pubKey, err, c.errs)
+			}
+		}
+	}
+}
+
+//TestP256LegacyPublicKey P256兼容最初钱包的X||Y公钥，secp256k1不接受
+func TestP256LegacyPublicKey(t *testing.T) {
+	for _, sv := range schemeVectors {
+		v := sv.sigs[0]
+		priKey := mustHex(t, v.priKey)
+		uncompressed, _ := sv.scheme.PublicKey(priKey, false)
+		hash := sha256.Sum256([]byte(v.message))
+		sig, _ := sv.scheme.Sign(priKey, hash[:])
+
+		err := sv.scheme.Verify(uncompressed[1:], hash[:], sig)
+		switch sv.scheme.Name() {
+		case SchemeP256:
+			if err != nil {
+				t.Errorf("X||Y公钥校验失败: %v", err)
+			}
+		default:
+			if err != ErrPubKeyFormat {
+				t.Errorf("%s: X||Y公钥的错误为%v", sv.scheme.Name(), err)
+			}
+		}
+	}
+}
+
+//TestSelectScheme 选择签名方案时不修改网络的默认参数
+func TestSelectScheme(t *testing.T) {
+	defer SelectNetwork("")
+	//使用临时的数据库文件
+	params := RegTestParams
+	params.DBFile = filepath.Join(t.TempDir(), "blockchain_test.db")
+	activeNetParams = &params
+
+	if err := SelectScheme(SchemeP256); err != nil {
+		t.Fatal(err)
+	}
+	if activeNetParams.Scheme.Name() != SchemeP256 || activeNetParams.Name != RegTestParams.Name {
+		t.Errorf("当前网络为%s，签名方案为%s", activeNetParams.Name, activeNetParams.Scheme.Name())
+	}
+	if RegTestParams.Scheme.Name() != SchemeSecp256k1 || params.Scheme.Name() != SchemeSecp256k1 {
+		t.Error("选择签名方案修改了网络的默认参数")
+	}
+	if err := SelectScheme("ed25519"); err != ErrUnknownScheme {
+		t.Errorf("未知签名方案的错误为%v", err)
+	}
+
+	//创建区块链时记录签名方案，之后不设置环境变量也使用记录的签名方案，设置不一致的签名方案时返回错误
+	if err := CreateBlockChain(encodeAddress(pubKeyHashAddrID, make([]byte, 20))); err != nil {
+		t.Fatal(err)
+	}
+	activeNetParams = &params
+	if err := SelectScheme(""); err != nil {
+		t.Fatal(err)
+	}
+	if activeNetParams.Scheme.Name() != SchemeP256 {
+		t.Errorf("没有设置环境变量时签名方案为%s，期望数据库记录的%s", activeNetParams.Scheme.Name(), SchemeP256)
+	}
+	bc, err := GetBlockChainInstance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.db.Close()
+	activeNetParams = &params
+	if err := SelectScheme(SchemeSecp256k1); err == nil {
+		t.Error("与数据库记录不一致的签名方案没有返回错误")
+	}
+	if _, err := GetBlockChainInstance(); err == nil {
+		t.Error("签名方案与数据库记录不一致时打开了区块链")
+	}
+}
@@ -0,0 +1,587 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+	脚本：
+		output的锁定脚本（scriptPubKey）规定花费条件，input的解锁脚本（scriptSig）提供满足条件的数据。
+		校验input时先执行解锁脚本（只能包含push操作），再用得到的栈执行锁定脚本，
+		执行成功且栈顶为真时input有效。
+		操作码与比特币一致，只实现了以下部分：
+			push数据、OP_0到OP_16、OP_1NEGATE
+			OP_NOP、OP_VERIFY、OP_RETURN、OP_DROP、OP_DUP、OP_EQUAL、OP_EQUALVERIFY
+			OP_SHA256、OP_HASH160、OP_CHECKSIG、OP_CHECKSIGVERIFY、OP_CHECKMULTISIG、OP_CHECKMULTISIGVERIFY
+			OP_CHECKLOCKTIMEVERIFY
+		签名数据：所有input的解锁脚本置空，被校验input的解锁脚本替换为正在执行的脚本（P2SH为赎回脚本），对交易序列化结果计算哈希。
+*/
+
+//操作码
+const (
+	OP_0                   = 0x00
+	OP_PUSHDATA1           = 0x4c
+	OP_PUSHDATA2           = 0x4d
+	OP_PUSHDATA4           = 0x4e
+	OP_1NEGATE             = 0x4f
+	OP_1                   = 0x51
+	OP_16                  = 0x60
+	OP_NOP                 = 0x61
+	OP_VERIFY              = 0x69
+	OP_RETURN              = 0x6a
+	OP_DROP                = 0x75
+	OP_DUP                 = 0x76
+	OP_EQUAL               = 0x87
+	OP_EQUALVERIFY         = 0x88
+	OP_SHA256              = 0xa8
+	OP_HASH160             = 0xa9
+	OP_CHECKSIG            = 0xac
+	OP_CHECKSIGVERIFY      = 0xad
+	OP_CHECKMULTISIG       = 0xae
+	OP_CHECKMULTISIGVERIFY = 0xaf
+	OP_CHECKLOCKTIMEVERIFY = 0xb1
+)
+
+//操作码名称（反汇编使用）
+var opcodeNames = map[byte]string{
+	OP_0:                   "OP_0",
+	OP_1NEGATE:             "OP_1NEGATE",
+	OP_NOP:                 "OP_NOP",
+	OP_VERIFY:              "OP_VERIFY",
+	OP_RETURN:              "OP_RETURN",
+	OP_DROP:                "OP_DROP",
+	OP_DUP:                 "OP_DUP",
+	OP_EQUAL:               "OP_EQUAL",
+	OP_EQUALVERIFY:         "OP_EQUALVERIFY",
+	OP_SHA256:              "OP_SHA256",
+	OP_HASH160:             "OP_HASH160",
+	OP_CHECKSIG:            "OP_CHECKSIG",
+	OP_CHECKSIGVERIFY:      "OP_CHECKSIGVERIFY",
+	OP_CHECKMULTISIG:       "OP_CHECKMULTISIG",
+	OP_CHECKMULTISIGVERIFY: "OP_CHECKMULTISIGVERIFY",
+	OP_CHECKLOCKTIMEVERIFY: "OP_CHECKLOCKTIMEVERIFY",
+}
+
+//脚本限制
+const (
+	maxScriptSize         = 10000 //脚本的最大字节数
+	maxScriptElementSize  = 520   //栈中元素的最大字节数
+	maxStackSize          = 1000  //栈中元素的最大个数
+	maxPubKeysPerMultisig = 20    //多重签名的最大公钥个数
+	lockTimeThreshold     = 500000000
+)
+
+//脚本错误
+var (
+	ErrScriptTooLarge      = errors.New("脚本过长")
+	ErrScriptMalformed     = errors.New("脚本格式错误")
+	ErrScriptBadOpcode     = errors.New("不支持的操作码")
+	ErrScriptPushOnly      = errors.New("解锁脚本只能包含push操作")
+	ErrScriptStackSize     = errors.New("栈中元素过多或过大")
+	ErrScriptStackUnderrun = errors.New("栈中元素不足")
+	ErrScriptVerify        = errors.New("脚本校验失败")
+	ErrScriptReturn        = errors.New("脚本执行了OP_RETURN")
+	ErrScriptBadNumber     = errors.New("数字编码无效")
+	ErrScriptNullFail      = errors.New("非空签名没有通过校验")
+	ErrScriptNullDummy     = errors.New("多重签名的多余元素必须为空")
+	ErrScriptBadMultisig   = errors.New("多重签名的公钥或签名个数无效")
+	ErrScriptLockTime      = errors.New("交易的锁定时间不满足脚本要求")
+	ErrScriptFalse         = errors.New("脚本执行结束时栈顶为假")
+)
+
+//scriptOp 解析后的一条脚本指令
+type scriptOp struct {
+	opcode byte
+	data   []byte //push操作的数据
+}
+
+//isPush 判断指令是否为push操作
+func (op scriptOp) isPush() bool {
+	return op.opcode <= OP_16 && op.opcode != 0x50
+}
+
+//parseScript 将脚本解析为指令序列
+func parseScript(script []byte) ([]scriptOp, error) {
+	if len(script) > maxScriptSize {
+		return nil, ErrScriptTooLarge
+	}
+	var ops []scriptOp
+	for i := 0; i < len(script); {
+		opcode := script[i]
+		i++
+
+		//push数据的长度
+		var n int
+		switch {
+		case opcode > OP_0 && opcode < OP_PUSHDATA1:
+			n = int(opcode)
+		case opcode == OP_PUSHDATA1:
+			if i+1 > len(script) {
+				return nil, ErrScriptMalformed
+			}
+			n = int(script[i])
+			i++
+		case opcode == OP_PUSHDATA2:
+			if i+2 > len(script) {
+				return nil, ErrScriptMalformed
+			}
+			n = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		case opcode == OP_PUSHDATA4:
+			if i+4 > len(script) {
+				return nil, ErrScriptMalformed
+			}
+			n = int(binary.LittleEndian.Uint32(script[i:]))
+			i += 4
+		}
+		if n < 0 || i+n > len(script) {
+			return nil, ErrScriptMalformed
+		}
+		ops = append(ops, scriptOp{opcode, script[i : i+n]})
+		i += n
+	}
+	return ops, nil
+}
+
+//pushData 生成push数据的指令（使用最短的编码）
+func pushData(data []byte) []byte {
+	n := len(data)
+	switch {
+	case n == 0:
+		return []byte{OP_0}
+	case n < OP_PUSHDATA1:
+		return append([]byte{byte(n)}, data...)
+	case n <= 0xff:
+		return append([]byte{OP_PUSHDATA1, byte(n)}, data...)
+	case n <= 0xffff:
+		buf := []byte{OP_PUSHDATA2, 0, 0}
+		binary.LittleEndian.PutUint16(buf[1:], uint16(n))
+		return append(buf, data...)
+	default:
+		buf := []byte{OP_PUSHDATA4, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(buf[1:], uint32(n))
+		return append(buf, data...)
+	}
+}
+
+//pushNumber 生成push小整数的指令（0到16使用OP_0到OP_16）
+func pushNumber(n int64) []byte {
+	if n == 0 {
+		return []byte{OP_0}
+	}
+	if n >= 1 && n <= 16 {
+		return []byte{byte(OP_1 + n - 1)}
+	}
+	return pushData(encodeScriptNum(n))
+}
+
+//isPushOnly 判断脚本是否只包含push操作
+func isPushOnly(script []byte) bool {
+	ops, err := parseScript(script)
+	if err != nil {
+		return false
+	}
+	for _, op := range ops {
+		if !op.isPush() {
+			return false
+		}
+	}
+	return true
+}
+
+//DisasmScript 将脚本反汇编为可读的字符串
+func DisasmScript(script []byte) string {
+	ops, err := parseScript(script)
+	if err != nil {
+		return fmt.Sprintf("[error: %v] %x", err, script)
+	}
+	var words []string
+	for _, op := range ops {
+		switch {
+		case op.opcode > OP_0 && op.opcode <= OP_PUSHDATA4:
+			words = append(words, fmt.Sprintf("%x", op.data))
+		case op.opcode >= OP_1 && op.opcode <= OP_16:
+			words = append(words, fmt.Sprintf("OP_%d", op.opcode-OP_1+1))
+		case opcodeNames[op.opcode] != "":
+			words = append(words, opcodeNames[op.opcode])
+		default:
+			words = append(words, fmt.Sprintf("OP_UNKNOWN_%02x", op.opcode))
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+//encodeScriptNum 将整数编码为脚本中的数字：小端字节序，最高字节的最高位为符号位，使用最短编码
+func encodeScriptNum(n int64) []byte {
+	if n == 0 {
+		return nil
+	}
+	negative := n < 0
+	abs := uint64(n)
+	if negative {
+		abs = uint64(-n)
+	}
+	var buf []byte
+	for abs > 0 {
+		buf = append(buf, byte(abs&0xff))
+		abs >>= 8
+	}
+	if buf[len(buf)-1]&0x80 != 0 {
+		if negative {
+			buf = append(buf, 0x80)
+		} else {
+			buf = append(buf, 0x00)
+		}
+	} else if negative {
+		buf[len(buf)-1] |= 0x80
+	}
+	return buf
+}
+
+//decodeScriptNum 解析脚本中的数字，最多maxLen个字节且必须使用最短编码
+func decodeScriptNum(data []byte, maxLen int) (int64, error) {
+	if len(data) > maxLen {
+		return 0, ErrScriptBadNumber
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	//最高字节除符号位外为0时，次高字节的最高位必须为1，否则不是最短编码
+	last := data[len(data)-1]
+	if last&0x7f == 0 && (len(data) == 1 || data[len(data)-2]&0x80 == 0) {
+		return 0, ErrScriptBadNumber
+	}
+	var n int64
+	for i, b := range data {
+		n |= int64(b) << uint(8*i)
+	}
+	if last&0x80 != 0 {
+		n &^= int64(0x80) << uint(8*(len(data)-1))
+		n = -n
+	}
+	return n, nil
+}
+
+//castToBool 栈中元素转换为布尔值：全为0（包括负0）为假
+func castToBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			//负0
+			if i == len(data)-1 && b == 0x80 {
+				return false
+			}
+			return true
+		}
+	}
+	return false
+}
+
+//scriptEngine 脚本执行引擎
+type scriptEngine struct {
+	tx    *Transaction //被校验的交易
+	index int          //被校验的input
+	stack [][]byte     //数据栈
+}
+
+//push 压栈
+func (vm *scriptEngine) push(data []byte) error {
+	if len(data) > maxScriptElementSize || len(vm.stack) >= maxStackSize {
+		return ErrScriptStackSize
+	}
+	vm.stack = append(vm.stack, data)
+	return nil
+}
+
+//pop 出栈
+func (vm *scriptEngine) pop() ([]byte, error) {
+	if len(vm.stack) == 0 {
+		return nil, ErrScriptStackUnderrun
+	}
+	data := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return data, nil
+}
+
+//pushBool 压入布尔值
+func (vm *scriptEngine) pushBool(v bool) error {
+	if v {
+		return vm.push([]byte{1})
+	}
+	return vm.push(nil)
+}
+
+//popNumber 弹出一个数字（最多4字节）
+func (vm *scriptEngine) popNumber() (int64, error) {
+	data, err := vm.pop()
+	if err != nil {
+		return 0, err
+	}
+	return decodeScriptNum(data, 4)
+}
+
+//execute 执行脚本
+func (vm *scriptEngine) execute(script []byte) error {
+	ops, err := parseScript(script)
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		err := vm.step(op, script)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//step 执行一条指令（script为正在执行的脚本，用于计算签名数据）
+func (vm *scriptEngine) step(op scriptOp, script []byte) error {
+	switch {
+	case op.opcode == OP_0 || (op.opcode > OP_0 && op.opcode <= OP_PUSHDATA4):
+		return vm.push(op.data)
+	case op.opcode == OP_1NEGATE:
+		return vm.push(encodeScriptNum(-1))
+	case op.opcode >= OP_1 && op.opcode <= OP_16:
+		return vm.push(encodeScriptNum(int64(op.opcode - OP_1 + 1)))
+	}
+
+	switch op.opcode {
+	case OP_NOP:
+		return nil
+
+	case OP_VERIFY:
+		data, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		if !castToBool(data) {
+			return ErrScriptVerify
+		}
+		return nil
+
+	case OP_RETURN:
+		return ErrScriptReturn
+
+	case OP_DROP:
+		_, err := vm.pop()
+		return err
+
+	case OP_DUP:
+		if len(vm.stack) == 0 {
+			return ErrScriptStackUnderrun
+		}
+		return vm.push(vm.stack[len(vm.stack)-1])
+
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		if op.opcode == OP_EQUALVERIFY {
+			if !bytes.Equal(a, b) {
+				return ErrScriptVerify
+			}
+			return nil
+		}
+		return vm.pushBool(bytes.Equal(a, b))
+
+	case OP_SHA256:
+		data, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(data)
+		return vm.push(hash[:])
+
+	case OP_HASH160:
+		data, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		//与公钥哈希的计算方式相同：先sha256再ripemd160
+		return vm.push(GetPubKeyHashFromPublicKey(data))
+
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		pubKey, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		sig, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		ok, err := vm.checkSig(sig, pubKey, script)
+		if err != nil {
+			return err
+		}
+		if op.opcode == OP_CHECKSIGVERIFY {
+			if !ok {
+				return ErrScriptVerify
+			}
+			return nil
+		}
+		return vm.pushBool(ok)
+
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		ok, err := vm.checkMultisig(script)
+		if err != nil {
+			return err
+		}
+		if op.opcode == OP_CHECKMULTISIGVERIFY {
+			if !ok {
+				return ErrScriptVerify
+			}
+			return nil
+		}
+		return vm.pushBool(ok)
+
+	case OP_CHECKLOCKTIMEVERIFY:
+		return vm.checkLockTime()
+	}
+	return ErrScriptBadOpcode
+}
+
+//checkSig 校验签名：空签名返回false，非空签名校验失败时返回错误
+func (vm *scriptEngine) checkSig(sig []byte, pubKey []byte, script []byte) (bool, error) {
+	if len(sig) == 0 {
+		return false, nil
+	}
+	hash := vm.tx.signatureHash(vm.index, script)
+	if err := activeNetParams.Scheme.Verify(pubKey, hash, sig); err != nil {
+		return false, fmt.Errorf("%w: %v", ErrScriptNullFail, err)
+	}
+	return true, nil
+}
+
+//checkMultisig 多重签名：栈中依次为 多余元素 签名1..签名m m 公钥1..公钥n n（n在栈顶）
+//签名必须按公钥的顺序排列
+func (vm *scriptEngine) checkMultisig(script []byte) (bool, error) {
+	n, err := vm.popNumber()
+	if err != nil {
+		return false, err
+	}
+	if n < 0 || n > maxPubKeysPerMultisig {
+		return false, ErrScriptBadMultisig
+	}
+	pubKeys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		if pubKeys[i], err = vm.pop(); err != nil {
+			return false, err
+		}
+	}
+	m, err := vm.popNumber()
+	if err != nil {
+		return false, err
+	}
+	if m < 0 || m > n {
+		return false, ErrScriptBadMultisig
+	}
+	sigs := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		if sigs[i], err = vm.pop(); err != nil {
+			return false, err
+		}
+	}
+	//与比特币一致，多弹出一个元素，且必须为空
+	dummy, err := vm.pop()
+	if err != nil {
+		return false, err
+	}
+	if len(dummy) != 0 {
+		return false, ErrScriptNullDummy
+	}
+
+	//每个签名依次与剩余的公钥匹配
+	k := 0
+	for _, sig := range sigs {
+		if len(sig) == 0 {
+			return false, nil
+		}
+		hash := vm.tx.signatureHash(vm.index, script)
+		for k < len(pubKeys) && activeNetParams.Scheme.Verify(pubKeys[k], hash, sig) != nil {
+			k++
+		}
+		if k == len(pubKeys) {
+			return false, ErrScriptNullFail
+		}
+		k++
+	}
+	return true, nil
+}
+
+//checkLockTime 栈顶的锁定时间不能大于交易的锁定时间，且类型（高度或时间）一致
+//input的序号为最终值时交易的锁定时间不生效，校验失败
+func (vm *scriptEngine) checkLockTime() error {
+	if len(vm.stack) == 0 {
+		return ErrScriptStackUnderrun
+	}
+	lockTime, err := decodeScriptNum(vm.stack[len(vm.stack)-1], 5)
+	if err != nil {
+		return err
+	}
+	if lockTime < 0 {
+		return ErrScriptLockTime
+	}
+	txLockTime := int64(vm.tx.LockTime)
+	if (lockTime < lockTimeThreshold) != (txLockTime < lockTimeThreshold) {
+		return ErrScriptLockTime
+	}
+	if lockTime > txLockTime {
+		return ErrScriptLockTime
+	}
+	if vm.tx.TXInputs[vm.index].Sequence == SequenceFinal {
+		return ErrScriptLockTime
+	}
+	return nil
+}
+
+//VerifyScript 校验第index个input：执行解锁脚本和引用output的锁定脚本
+//锁定脚本为P2SH脚本时，再用解锁脚本压栈的数据执行其中最后一个元素（赎回脚本）
+func VerifyScript(scriptSig []byte, scriptPubKey []byte, tx *Transaction, index int) error {
+	if !isPushOnly(scriptSig) {
+		return ErrScriptPushOnly
+	}
+	vm := scriptEngine{tx: tx, index: index}
+	err := vm.execute(scriptSig)
+	if err != nil {
+		return err
+	}
+	//保存解锁脚本执行后的栈，P2SH使用
+	sigStack := append([][]byte{}, vm.stack...)
+
+	err = vm.execute(scriptPubKey)
+	if err != nil {
+		return err
+	}
+	if !vm.topIsTrue() {
+		return ErrScriptFalse
+	}
+
+	if isP2SH(scriptPubKey) {
+		//锁定脚本已校验赎回脚本的哈希
+		redeemScript := sigStack[len(sigStack)-1]
+		vm.stack = sigStack[:len(sigStack)-1]
+		err = vm.execute(redeemScript)
+		if err != nil {
+			return err
+		}
+		if !vm.topIsTrue() {
+			return ErrScriptFalse
+		}
+	}
+	return nil
+}
+
+//topIsTrue 判断栈顶元素是否为真
+func (vm *scriptEngine) topIsTrue() bool {
+	return len(vm.stack) > 0 && castToBool(vm.stack[len(vm.stack)-1])
+}
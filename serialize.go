@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+/*
+	二进制格式（wire format）：
+		交易、区块、output的序列化、交易ID和区块哈希都基于以下格式，与编程语言无关。
+		所有整数均为小端字节序。
+
+		基本类型：
+			uint32/uint64/int64 - 定长4/8/8字节
+			varint - 变长整数（与比特币的CompactSize相同，必须使用最短编码）：
+				< 0xfd        1字节
+				<= 0xffff     0xfd + uint16
+				<= 0xffffffff 0xfe + uint32
+				其他          0xff + uint64
+			bytes - varint长度 + 数据
+
+		TXInput：
+			bytes   TXID       引用output所在交易的ID
+			int64   Index      引用output的索引（挖矿交易为-1）
+			bytes   ScriptSig  解锁脚本（挖矿交易为区块高度+矿工数据）
+			uint32  Sequence   序号
+
+		TXOutput：
+			int64  Value         金额（最小单位）
+			bytes  ScriptPubKey  锁定脚本
+
+		Transaction：
+			uint32    Version    交易版本（当前为2）
+			bytes     TXID       交易ID
+			varint    input个数，之后依次为每个TXInput
+			varint    output个数，之后依次为每个TXOutput
+			uint64    TimeStamp  创建交易的时间
+			uint32    LockTime   锁定时间
+
+			交易ID = SHA256(TXID为空、所有ScriptSig为空时的交易序列化结果)
+			挖矿交易例外：交易ID = SHA256(TXID为空时的交易序列化结果)，
+			         ScriptSig保留（其中的区块高度和矿工数据使不同区块的挖矿交易ID不同）
+			签名数据 = SHA256(所有ScriptSig为空、被校验input的ScriptSig替换为正在执行的脚本时的交易序列化结果，见script.go)
+
+		区块头：
+			uint64  Version     区块版本（当前为1）
+			bytes   PrevHash    前区块哈希（创世块为空）
+			bytes   MerkleRoot  梅克尔根
+			uint64  TimeStamp   时间戳
+			uint64  Bits        压缩格式的难度
+			uint64  Nonce       随机数
+
+			区块哈希 = SHA256(区块头序列化结果)
+
+		Block：
+			区块头
+			uint64  Height  区块高度（不参与哈希计算）
+			bytes   Hash    区块哈希
+			varint  交易个数，之后依次为每个Transaction
+
+		版本为0的交易和区块由migratedb从旧的gob格式转换而来，版本为1的交易由migratedb从没有脚本的格式转换而来：
+			output的公钥哈希转换为P2PKH锁定脚本，input的签名和公钥转换为P2PKH解锁脚本；
+			交易ID为转换前记录的值（gob编码依赖Go的实现，格式转换后也无法重新计算），不能再放入新的区块；
+			区块哈希 = SHA256(Version | PrevHash | MerkleRoot | TimeStamp | Bits | Nonce)，各字段直接拼接，没有长度前缀。
+*/
+
+//交易版本
+const (
+	TxVersionLegacy     uint32 = 0 //从gob格式转换的交易
+	TxVersionPubKeyHash uint32 = 1 //使用公钥哈希锁定output的交易（没有脚本）
+	TxVersion           uint32 = 2 //当前版本
+)
+
+//区块版本
+const (
+	BlockVersionLegacy uint64 = 0 //从gob格式转换的区块
+	BlockVersion       uint64 = 1 //当前版本
+)
+
+//反序列化错误
+var (
+	ErrWireTruncated    = errors.New("数据不完整")
+	ErrWireTooLarge     = errors.New("长度超出数据范围")
+	ErrWireNonCanonical = errors.New("变长整数没有使用最短编码")
+	ErrWireTrailing     = errors.New("数据末尾有多余的字节")
+)
+
+//writeUint32 写入定长4字节整数
+func writeUint32(w *bytes.Buffer, v uint32) {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	w.Write(buf[:])
+}
+
+//writeUint64 写入定长8字节整数
+func writeUint64(w *bytes.Buffer, v uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	w.Write(buf[:])
+}
+
+//writeVarInt 写入变长整数
+func writeVarInt(w *bytes.Buffer, v uint64) {
+	switch {
+	case v < 0xfd:
+		w.WriteByte(byte(v))
+	case v <= 0xffff:
+		w.WriteByte(0xfd)
+		var buf [2]byte
+		binary.LittleEndian.PutUint16(buf[:], uint16(v))
+		w.Write(buf[:])
+	case v <= 0xffffffff:
+		w.WriteByte(0xfe)
+		writeUint32(w, uint32(v))
+	default:
+		w.WriteByte(0xff)
+		writeUint64(w, v)
+	}
+}
+
+//writeVarBytes 写入带长度前缀的字节流
+func writeVarBytes(w *bytes.Buffer, data []byte) {
+	writeVarInt(w, uint64(len(data)))
+	w.Write(data)
+}
+
+//readFull 读取n个字节
+func readFull(r *bytes.Reader, n uint64) ([]byte, error) {
+	if n > uint64(r.Len()) {
+		return nil, ErrWireTruncated
+	}
+	buf := make([]byte, n)
+	r.Read(buf)
+	return buf, nil
+}
+
+//readUint32 读取定长4字节整数
+func readUint32(r *bytes.Reader) (uint32, error) {
+	buf, err := readFull(r, 4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(buf), nil
+}
+
+//readUint64 读取定长8字节整数
+func readUint64(r *bytes.Reader) (uint64, error) {
+	buf, err := readFull(r, 8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(buf), nil
+}
+
+//readVarInt 读取变长整数，拒绝非最短编码
+func readVarInt(r *bytes.Reader) (uint64, error) {
+	prefix, err := r.ReadByte()
+	if err != nil {
+		return 0, ErrWireTruncated
+	}
+
+	var v, min uint64
+	switch prefix {
+	case 0xfd:
+		buf, err := readFull(r, 2)
+		if err != nil {
+			return 0, err
+		}
+		v, min = uint64(binary.LittleEndian.Uint16(buf)), 0xfd
+	case 0xfe:
+		v32, err := readUint32(r)
+		if err != nil {
+			return 0, err
+		}
+		v, min = uint64(v32), 0x10000
+	case 0xff:
+		v, err = readUint64(r)
+		if err != nil {
+			return 0, err
+		}
+		min = 0x100000000
+	default:
+		return uint64(prefix), nil
+	}
+	if v < min {
+		return 0, ErrWireNonCanonical
+	}
+	return v, nil
+}
+
+//readVarBytes 读取带长度前缀的字节流（长度为0时返回nil）
+func readVarBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(r.Len()) {
+		return nil, ErrWireTooLarge
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	return readFull(r, n)
+}
+
+//readCount 读取元素个数，每个元素至少占minSize个字节
+func readCount(r *bytes.Reader, minSize uint64) (uint64, error) {
+	n, err := readVarInt(r)
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(r.Len())/minSize {
+		return 0, ErrWireTooLarge
+	}
+	return n, nil
+}
+
+//encode 序列化input
+func (input *TXInput) encode(w *bytes.Buffer) {
+	writeVarBytes(w, input.TXID)
+	writeUint64(w, uint64(input.Index))
+	writeVarBytes(w, input.ScriptSig)
+	writeUint32(w, input.Sequence)
+}
+
+//decodeTXInput 反序列化input
+func decodeTXInput(r *bytes.Reader) (TXInput, error) {
+	var input TXInput
+	var err error
+	if input.TXID, err = readVarBytes(r); err != nil {
+		return input, err
+	}
+	index, err := readUint64(r)
+	if err != nil {
+		return input, err
+	}
+	input.Index = int64(index)
+	if input.ScriptSig, err = readVarBytes(r); err != nil {
+		return input, err
+	}
+	input.Sequence, err = readUint32(r)
+	return input, err
+}
+
+//encode 序列化output
+func (output *TXOutput) encode(w *bytes.Buffer) {
+	writeUint64(w, uint64(output.Value))
+	writeVarBytes(w, output.ScriptPubKey)
+}
+
+//decodeTXOutput 反序列化output
+func decodeTXOutput(r *bytes.Reader) (TXOutput, error) {
+	var output TXOutput
+	value, err := readUint64(r)
+	if err != nil {
+		return output, err
+	}
+	output.Value = Amount(value)
+	output.ScriptPubKey, err = readVarBytes(r)
+	return output, err
+}
+
+//encode 序列化交易
+func (tx *Transaction) encode(w *bytes.Buffer) {
+	writeUint32(w, tx.Version)
+	writeVarBytes(w, tx.TXID)
+	writeVarInt(w, uint64(len(tx.TXInputs)))
+	for i := range tx.TXInputs {
+		tx.TXInputs[i].encode(w)
+	}
+	writeVarInt(w, uint64(len(tx.TXOutputs)))
+	for i := range tx.TXOutputs {
+		tx.TXOutputs[i].encode(w)
+	}
+	writeUint64(w, tx.TimeStamp)
+	writeUint32(w, tx.LockTime)
+}
+
+//decodeTransaction 反序列化交易
+func decodeTransaction(r *bytes.Reader) (*Transaction, error) {
+	var tx Transaction
+	var err error
+	if tx.Version, err = readUint32(r); err != nil {
+		return nil, err
+	}
+	if tx.TXID, err = readVarBytes(r); err != nil {
+		return nil, err
+	}
+
+	//input至少14字节（2个长度前缀+8字节索引+4字节序号），output至少9字节
+	inputCount, err := readCount(r, 14)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < inputCount; i++ {
+		input, err := decodeTXInput(r)
+		if err != nil {
+			return nil, err
+		}
+		tx.TXInputs = append(tx.TXInputs, input)
+	}
+	outputCount, err := readCount(r, 9)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < outputCount; i++ {
+		output, err := decodeTXOutput(r)
+		if err != nil {
+			return nil, err
+		}
+		tx.TXOutputs = append(tx.TXOutputs, output)
+	}
+
+	if tx.TimeStamp, err = readUint64(r); err != nil {
+		return nil, err
+	}
+	if tx.LockTime, err = readUint32(r); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+//serializeHeader 序列化区块头（nonce由调用者指定，挖矿时使用）
+func (b *Block) serializeHeader(nonce uint64) []byte {
+	var w bytes.Buffer
+	writeUint64(&w, b.Version)
+	writeVarBytes(&w, b.PrevHash)
+	writeVarBytes(&w, b.MerkleRoot)
+	writeUint64(&w, b.TimeStamp)
+	writeUint64(&w, b.Bits)
+	writeUint64(&w, nonce)
+	return w.Bytes()
+}
+
+//decodeBlock 反序列化区块
+func decodeBlock(r *bytes.Reader) (*Block, error) {
+	var b Block
+	var err error
+	if b.Version, err = readUint64(r); err != nil {
+		return nil, err
+	}
+	if b.PrevHash, err = readVarBytes(r); err != nil {
+		return nil, err
+	}
+	if b.MerkleRoot, err = readVarBytes(r); err != nil {
+		return nil, err
+	}
+	if b.TimeStamp, err = readUint64(r); err != nil {
+		return nil, err
+	}
+	if b.Bits, err = readUint64(r); err != nil {
+		return nil, err
+	}
+	if b.Nonce, err = readUint64(r); err != nil {
+		return nil, err
+	}
+	if b.Height, err = readUint64(r); err != nil {
+		return nil, err
+	}
+	if b.Hash, err = readVarBytes(r); err != nil {
+		return nil, err
+	}
+
+	//交易至少19字节（版本、TXID长度、input和output个数、时间戳、锁定时间）
+	count, err := readCount(r, 19)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < count; i++ {
+		tx, err := decodeTransaction(r)
+		if err != nil {
+			return nil, fmt.Errorf("交易%d: %w", i, err)
+		}
+		b.Transactions = append(b.Transactions, tx)
+	}
+	return &b, nil
+}
+
+//checkTrailing 反序列化结束后不能有多余的字节
+func checkTrailing(r *bytes.Reader) error {
+	if r.Len() != 0 {
+		return ErrWireTrailing
+	}
+	return nil
+}
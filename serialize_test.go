@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+//mustHex 解码测试数据中的十六进制字符串
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+//newTestTransactions 创建测试用的挖矿交易和普通交易（空的字节流使用nil，与反序列化的结果一致）
+func newTestTransactions() []*Transaction {
+	coinbase := &Transaction{
+		Version: TxVersion,
+		TXID:    bytes.Repeat([]byte{0x11}, 32),
+		TXInputs: []TXInput{
+			{TXID: nil, Index: -1, ScriptSig: []byte{0x01, 0x02, 0x03}, Sequence: SequenceFinal},
+		},
+		TXOutputs: []TXOutput{
+			{Value: 50 * CoinUnit, ScriptPubKey: NewP2PKHScript(bytes.Repeat([]byte{0x22}, 20))},
+		},
+		TimeStamp: 1600000000000000000,
+	}
+	normal := &Transaction{
+		Version: TxVersion,
+		TXID:    bytes.Repeat([]byte{0x33}, 32),
+		TXInputs: []TXInput{
+			{TXID: bytes.Repeat([]byte{0x11}, 32), Index: 0, ScriptSig: bytes.Repeat([]byte{0x44}, 300), Sequence: 10},
+			{TXID: bytes.Repeat([]byte{0x55}, 32), Index: 7, ScriptSig: nil, Sequence: SequenceFinal - 1},
+		},
+		TXOutputs: []TXOutput{
+			{Value: 1, ScriptPubKey: NewP2SHScript(bytes.Repeat([]byte{0x66}, 20))},
+			{Value: 0, ScriptPubKey: NewNullDataScript([]byte("data"))},
+			{Value: MaxMoney, ScriptPubKey: nil},
+		},
+		TimeStamp: 1600000000000000001,
+		LockTime:  500000001,
+	}
+	return []*Transaction{coinbase, normal}
+}
+
+//TestTXInputRoundTrip input序列化后反序列化得到相同的数据
+func TestTXInputRoundTrip(t *testing.T) {
+	for _, tx := range newTestTransactions() {
+		for _, input := range tx.TXInputs {
+			var w bytes.Buffer
+			input.encode(&w)
+			r := bytes.NewReader(w.Bytes())
+			got, err := decodeTXInput(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := checkTrailing(r); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, input) {
+				t.Errorf("反序列化得到%+v，期望%+v", got, input)
+			}
+		}
+	}
+}
+
+//TestTXOutputRoundTrip output序列化后反序列化得到相同的数据
+func TestTXOutputRoundTrip(t *testing.T) {
+	for _, tx := range newTestTransactions() {
+		for _, output := range tx.TXOutputs {
+			data, err := serializeTXOutput(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := deSerializeTXOutput(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, output) {
+				t.Errorf("反序列化得到%+v，期望%+v", got, output)
+			}
+		}
+	}
+}
+
+//TestTransactionRoundTrip 交易序列化后反序列化得到相同的数据，再次序列化得到相同的字节流
+func TestTransactionRoundTrip(t *testing.T) {
+	for _, tx := range newTestTransactions() {
+		data := tx.Serialize()
+		got := DeSerializeTransaction(data)
+		if got == nil {
+			t.Fatal("反序列化交易失败")
+		}
+		if !reflect.DeepEqual(got, tx) {
+			t.Errorf("反序列化得到%+v，期望%+v", got, tx)
+		}
+		if !bytes.Equal(got.Serialize(), data) {
+			t.Error("再次序列化的结果不同")
+		}
+	}
+}
+
+//TestBlockRoundTrip 区块序列化后反序列化得到相同的数据
+func TestBlockRoundTrip(t *testing.T) {
+	block := &Block{
+		Version:      BlockVersion,
+		Height:       7,
+		PrevHash:     bytes.Repeat([]byte{0x77}, 32),
+		MerkleRoot:   bytes.Repeat([]byte{0x88}, 32),
+		TimeStamp:    1600000000000000002,
+		Bits:         0x207fffff,
+		Nonce:        12345,
+		Hash:         bytes.Repeat([]byte{0x99}, 32),
+		Transactions: newTestTransactions(),
+	}
+	//创世块没有前区块哈希
+	genesis := *block
+	genesis.Height = 0
+	genesis.PrevHash = nil
+	genesis.Transactions = genesis.Transactions[:1]
+
+	for _, b := range []*Block{block, &genesis} {
+		data := b.Serialize()
+		got := DeSerialize(data)
+		if got == nil {
+			t.Fatal("反序列化区块失败")
+		}
+		if !reflect.DeepEqual(got, b) {
+			t.Errorf("反序列化得到%+v，期望%+v", got, b)
+		}
+		if !bytes.Equal(got.Serialize(), data) {
+			t.Error("再次序列化的结果不同")
+		}
+	}
+}
+
+//TestVarInt 变长整数在每种长度的边界使用最短编码，拒绝非最短编码和不完整的数据
+func TestVarInt(t *testing.T) {
+	cases := []struct {
+		value uint64
+		hex   string
+	}{
+		{0, "00"},
+		{0xfc, "fc"},
+		{0xfd, "fdfd00"},
+		{0xffff, "fdffff"},
+		{0x10000, "fe00000100"},
+		{0xffffffff, "feffffffff"},
+		{0x100000000, "ff0000000001000000"},
+	}
+	for _, c := range cases {
+		var w bytes.Buffer
+		writeVarInt(&w, c.value)
+		if hex.EncodeToString(w.Bytes()) != c.hex {
+			t.Errorf("%d编码为%x，期望%s", c.value, w.Bytes(), c.hex)
+		}
+		got, err := readVarInt(bytes.NewReader(mustHex(t, c.hex)))
+		if err != nil || got != c.value {
+			t.Errorf("%s解码为%d（%v），期望%d", c.hex, got, err, c.value)
+		}
+	}
+
+	errCases := []struct {
+		hex string
+		err error
+	}{
+		{"fdfc00", ErrWireNonCanonical},
+		{"feffff0000", ErrWireNonCanonical},
+		{"ffffffffff00000000", ErrWireNonCanonical},
+		{"ff0000000000000000", ErrWireNonCanonical},
+		{"", ErrWireTruncated},
+		{"fd01", ErrWireTruncated},
+		{"fe010000", ErrWireTruncated},
+		{"ff01000000000000", ErrWireTruncated},
+	}
+	for _, c := range errCases {
+		_, err := readVarInt(bytes.NewReader(mustHex(t, c.hex)))
+		if err != c.err {
+			t.Errorf("%s解码的错误为%v，期望%v", c.hex, err, c.err)
+		}
+	}
+}
+
+//TestDecodeErrors 长度前缀超出数据范围、数据不完整和末尾有多余字节时返回错误
+func TestDecodeErrors(t *testing.T) {
+	tx := newTestTransactions()[1]
+	data := tx.Serialize()
+
+	//字节流的长度前缀超出剩余的数据
+	if _, err := readVarBytes(bytes.NewReader(mustHex(t, "050102"))); err != ErrWireTooLarge {
+		t.Errorf("长度前缀超出数据范围的错误为%v", err)
+	}
+	//非最短编码的长度前缀
+	if _, err := readVarBytes(bytes.NewReader(mustHex(t, "fd0300010203"))); err != ErrWireNonCanonical {
+		t.Errorf("非最短编码的长度前缀的错误为%v", err)
+	}
+	//input个数超出剩余数据能容纳的个数
+	var w bytes.Buffer
+	writeUint32(&w, TxVersion)
+	writeVarBytes(&w, nil)
+	writeVarInt(&w, 1000)
+	w.Write(make([]byte, 100))
+	if _, err := decodeTransaction(bytes.NewReader(w.Bytes())); err != ErrWireTooLarge {
+		t.Errorf("input个数超出数据范围的错误为%v", err)
+	}
+
+	//截断的交易：每个位置截断都返回错误
+	for n := 0; n < len(data); n++ {
+		_, err := decodeTransaction(bytes.NewReader(data[:n]))
+		if err != ErrWireTruncated && err != ErrWireTooLarge {
+			t.Fatalf("截断为%d字节的交易的错误为%v", n, err)
+		}
+	}
+	if _, err := deSerializeTXOutput(mustHex(t, "0100000000")); err != ErrWireTruncated {
+		t.Errorf("截断的output的错误为%v", err)
+	}
+
+	//末尾有多余的字节
+	r := bytes.NewReader(append(append([]byte{}, data...), 0x00))
+	if _, err := decodeTransaction(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkTrailing(r); err != ErrWireTrailing {
+		t.Errorf("末尾有多余字节的交易的错误为%v", err)
+	}
+	output, _ := serializeTXOutput(tx.TXOutputs[0])
+	if _, err := deSerializeTXOutput(append(output, 0x00)); err != ErrWireTrailing {
+		t.Errorf("末尾有多余字节的output的错误为%v", err)
+	}
+	if DeSerializeTransaction(append(append([]byte{}, data...), 0x00)) != nil {
+		t.Error("末尾有多余字节的交易反序列化成功")
+	}
+
+	//区块中交易的错误包含交易的序号
+	block := &Block{Version: BlockVersion, Hash: []byte{0x01}, Transactions: []*Transaction{tx}}
+	blockData := block.Serialize()
+	_, err := decodeBlock(bytes.NewReader(blockData[:len(blockData)-1]))
+	if !errors.Is(err, ErrWireTruncated) {
+		t.Errorf("截断的区块的错误为%v", err)
+	}
+}
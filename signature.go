@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+/*
+	签名和公钥编码：
+		签名使用DER编码：0x30 总长度 0x02 r的长度 r 0x02 s的长度 s，
+		r和s为大端字节序的正整数，不能有多余的前导0，也不能为0。
+		签名时使用RFC6979由私钥和哈希确定性地生成k（不依赖随机数），
+		并将s规范为较小的值（s <= N/2），校验时拒绝s > N/2的签名，
+		否则任何人都可以把s替换为N-s得到另一个有效签名（签名延展性）。
+		公钥使用SEC1编码，X和Y按曲线的字节长度补齐前导0（P256为32字节）：
+			压缩格式   0x02或0x03（Y的奇偶） + X，33字节，钱包默认使用
+			未压缩格式 0x04 + X + Y，65字节
+		同一个私钥的两种编码得到不同的公钥哈希，也就是不同的地址。
+*/
+
+//签名和公钥编码错误
+var (
+	ErrSigDER       = errors.New("签名不是规范的DER编码")
+	ErrSigHighS     = errors.New("签名的s值过大")
+	ErrSigRange     = errors.New("签名的r或s超出范围")
+	ErrPubKeyFormat = errors.New("公钥不是有效的SEC1编码")
+	ErrPubKeyCurve  = errors.New("公钥不在曲线上")
+)
+
+//DER编码的签名长度范围（r和s各1到33字节）
+const (
+	minSigLength = 8
+	maxSigLength = 72
+)
+
+//curveByteSize 曲线坐标的字节长度
+func curveByteSize(curve elliptic.Curve) int {
+	return (curve.Params().BitSize + 7) / 8
+}
+
+//SEC1公钥的前缀
+const (
+	pubKeyCompressedEven = 0x02 //压缩格式，Y为偶数
+	pubKeyCompressedOdd  = 0x03 //压缩格式，Y为奇数
+	pubKeyUncompressed   = 0x04 //未压缩格式
+)
+
+//paddedBytes 将整数编码为定长的大端字节序
+func paddedBytes(v *big.Int, size int) []byte {
+	buf := make([]byte, size)
+	b := v.Bytes()
+	copy(buf[size-len(b):], b)
+	return buf
+}
+
+//encodePublicKey 将公钥编码为SEC1格式（compressed为true时使用压缩格式）
+func encodePublicKey(pub *ecdsa.PublicKey, compressed bool) []byte {
+	size := curveByteSize(pub.Curve)
+	if compressed {
+		prefix := byte(pubKeyCompressedEven)
+		if pub.Y.Bit(0) == 1 {
+			prefix = pubKeyCompressedOdd
+		}
+		return append([]byte{prefix}, paddedBytes(pub.X, size)...)
+	}
+	buf := []byte{pubKeyUncompressed}
+	buf = append(buf, paddedBytes(pub.X, size)...)
+	return append(buf, paddedBytes(pub.Y, size)...)
+}
+
+//parsePublicKey 解析SEC1编码的公钥（压缩或未压缩格式），坐标必须小于P且点在曲线上
+func parsePublicKey(curve elliptic.Curve, data []byte) (*ecdsa.PublicKey, error) {
+	params := curve.Params()
+	size := curveByteSize(curve)
+	if len(data) == 0 {
+		return nil, ErrPubKeyFormat
+	}
+
+	var x, y *big.Int
+	switch data[0] {
+	case pubKeyUncompressed:
+		if len(data) != 1+2*size {
+			return nil, ErrPubKeyFormat
+		}
+		x = new(big.Int).SetBytes(data[1 : 1+size])
+		y = new(big.Int).SetBytes(data[1+size:])
+	case pubKeyCompressedEven, pubKeyCompressedOdd:
+		if len(data) != 1+size {
+			return nil, ErrPubKeyFormat
+		}
+		x = new(big.Int).SetBytes(data[1:])
+		if x.Cmp(params.P) >= 0 {
+			return nil, ErrPubKeyCurve
+		}
+		y = decompressY(params, x, data[0] == pubKeyCompressedOdd)
+		if y == nil {
+			return nil, ErrPubKeyCurve
+		}
+	default:
+		return nil, ErrPubKeyFormat
+	}
+
+	if x.Cmp(params.P) >= 0 || y.Cmp(params.P) >= 0 || !curve.IsOnCurve(x, y) {
+		return nil, ErrPubKeyCurve
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+//decompressY 由X和Y的奇偶计算Y：y² = x³ - 3x + b (mod p)，没有解时返回nil
+func decompressY(params *elliptic.CurveParams, x *big.Int, odd bool) *big.Int {
+	p := params.P
+	//x³ - 3x + b
+	y2 := new(big.Int).Mul(x, x)
+	y2.Mul(y2, x)
+	threeX := new(big.Int).Lsh(x, 1)
+	threeX.Add(threeX, x)
+	y2.Sub(y2, threeX)
+	y2.Add(y2, params.B)
+	y2.Mod(y2, p)
+
+	y := new(big.Int).ModSqrt(y2, p)
+	if y == nil {
+		return nil
+	}
+	if (y.Bit(0) == 1) != odd {
+		y.Sub(p, y)
+	}
+	//y为0时不存在奇数解
+	if (y.Bit(0) == 1) != odd {
+		return nil
+	}
+	return y
+}
+
+//signLowS 使用RFC6979确定性的k签名，并将s规范为较小的值，返回DER编码的签名
+func signLowS(priKey *ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	n := priKey.Curve.Params().N
+	e := hashToInt(hash, n)
+	nonce := newRFC6979(priKey.D, hash, n)
+	for {
+		k := nonce.next()
+		//r = (k*G).x mod N
+		x, _ := priKey.Curve.ScalarBaseMult(paddedBytes(k, (n.BitLen()+7)/8))
+		r := new(big.Int).Mod(x, n)
+		if r.Sign() == 0 {
+			continue
+		}
+		//s = k⁻¹(e + r*d) mod N
+		s := new(big.Int).Mul(r, priKey.D)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, n))
+		s.Mod(s, n)
+		if s.Sign() == 0 {
+			continue
+		}
+		if !isLowS(n, s) {
+			s.Sub(n, s)
+		}
+		return encodeSignatureDER(r, s), nil
+	}
+}
+
+//hashToInt 取哈希的前qlen位（qlen为N的位数）作为整数
+func hashToInt(hash []byte, n *big.Int) *big.Int {
+	qlen := n.BitLen()
+	v := new(big.Int).SetBytes(hash)
+	if excess := len(hash)*8 - qlen; excess > 0 {
+		v.Rsh(v, uint(excess))
+	}
+	return v
+}
+
+//rfc6979 由私钥和哈希确定性地生成k（RFC6979 3.2，HMAC-SHA256）
+type rfc6979 struct {
+	n    *big.Int
+	k, v []byte
+}
+
+//newRFC6979 初始化：K = HMAC_K(V || 0x00 || 私钥 || 哈希 mod N)，V = HMAC_K(V)，再以0x01重复一次
+func newRFC6979(d *big.Int, hash []byte, n *big.Int) *rfc6979 {
+	size := (n.BitLen() + 7) / 8
+	h1 := new(big.Int).Mod(hashToInt(hash, n), n)
+	seed := append(paddedBytes(d, size), paddedBytes(h1, size)...)
+
+	g := rfc6979{n: n, k: make([]byte, sha256.Size), v: bytes.Repeat([]byte{0x01}, sha256.Size)}
+	for _, b := range []byte{0x00, 0x01} {
+		g.k = g.mac(g.v, []byte{b}, seed)
+		g.v = g.mac(g.v)
+	}
+	return &g
+}
+
+//mac 使用当前的K计算HMAC-SHA256
+func (g *rfc6979) mac(data ...[]byte) []byte {
+	m := hmac.New(sha256.New, g.k)
+	for _, d := range data {
+		m.Write(d)
+	}
+	return m.Sum(nil)
+}
+
+//next 生成下一个1到N-1之间的k，每次调用后更新K和V（签名结果无效时继续调用）
+func (g *rfc6979) next() *big.Int {
+	size := (g.n.BitLen() + 7) / 8
+	for {
+		var t []byte
+		for len(t) < size {
+			g.v = g.mac(g.v)
+			t = append(t, g.v...)
+		}
+		k := hashToInt(t[:size], g.n)
+		g.k = g.mac(g.v, []byte{0x00})
+		g.v = g.mac(g.v)
+		if k.Sign() > 0 && k.Cmp(g.n) < 0 {
+			return k
+		}
+	}
+}
+
+//isLowS 判断s是否不超过N/2
+func isLowS(n *big.Int, s *big.Int) bool {
+	halfN := new(big.Int).Rsh(n, 1)
+	return s.Cmp(halfN) <= 0
+}
+
+//encodeSignatureDER 将r和s编码为DER格式
+func encodeSignatureDER(r *big.Int, s *big.Int) []byte {
+	rb := derInteger(r)
+	sb := derInteger(s)
+	sig := make([]byte, 0, 6+len(rb)+len(sb))
+	sig = append(sig, 0x30, byte(4+len(rb)+len(sb)))
+	sig = append(sig, 0x02, byte(len(rb)))
+	sig = append(sig, rb...)
+	sig = append(sig, 0x02, byte(len(sb)))
+	sig = append(sig, sb...)
+	return sig
+}
+
+//derInteger 正整数的DER内容：大端字节序，最高位为1时补一个0
+func derInteger(v *big.Int) []byte {
+	b := v.Bytes()
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		b = append([]byte{0x00}, b...)
+	}
+	return b
+}
+
+//parseSignatureDER 严格解析DER编码的签名，拒绝任何不规范的编码，并要求s不超过N/2
+func parseSignatureDER(curve elliptic.Curve, sig []byte) (*big.Int, *big.Int, error) {
+	if len(sig) < minSigLength || len(sig) > maxSigLength {
+		return nil, nil, ErrSigDER
+	}
+	if sig[0] != 0x30 || int(sig[1]) != len(sig)-2 {
+		return nil, nil, ErrSigDER
+	}
+
+	rest := sig[2:]
+	r, rest, err := parseDERInteger(rest)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, rest, err := parseDERInteger(rest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rest) != 0 {
+		return nil, nil, ErrSigDER
+	}
+
+	n := curve.Params().N
+	if r.Sign() == 0 || s.Sign() == 0 || r.Cmp(n) >= 0 || s.Cmp(n) >= 0 {
+		return nil, nil, ErrSigRange
+	}
+	if !isLowS(n, s) {
+		return nil, nil, ErrSigHighS
+	}
+	return r, s, nil
+}
+
+//parseDERInteger 解析一个DER整数，返回整数和剩余的数据
+func parseDERInteger(data []byte) (*big.Int, []byte, error) {
+	if len(data) < 2 || data[0] != 0x02 {
+		return nil, nil, ErrSigDER
+	}
+	length := int(data[1])
+	if length == 0 || length > len(data)-2 {
+		return nil, nil, ErrSigDER
+	}
+	content := data[2 : 2+length]
+	//不能为负数
+	if content[0]&0x80 != 0 {
+		return nil, nil, ErrSigDER
+	}
+	//不能有多余的前导0
+	if length > 1 && content[0] == 0x00 && content[1]&0x80 == 0 {
+		return nil, nil, ErrSigDER
+	}
+	return new(big.Int).SetBytes(content), data[2+length:], nil
+}
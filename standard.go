@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+)
+
+/*
+	标准脚本模板：
+		P2PKH（pay to public key hash，付款给公钥哈希，即普通地址）：
+			锁定脚本 OP_DUP OP_HASH160 <20字节公钥哈希> OP_EQUALVERIFY OP_CHECKSIG
+			解锁脚本 <签名> <公钥>
+		执行过程：复制公钥，计算公钥哈希并与锁定脚本中的公钥哈希比较，再用公钥校验签名。
+
+	P2SH（pay to script hash，付款给脚本哈希）：
+			锁定脚本 OP_HASH160 <20字节赎回脚本哈希> OP_EQUAL
+			解锁脚本 <赎回脚本需要的数据...> <赎回脚本>
+		锁定脚本只校验赎回脚本的哈希，之后用解锁脚本中剩余的数据执行赎回脚本（见VerifyScript）。
+		地址使用版本0x05，由赎回脚本的哈希生成。
+
+	多重签名（M-of-N，作为P2SH的赎回脚本）：
+			赎回脚本 OP_M <公钥1> ... <公钥N> OP_N OP_CHECKMULTISIG
+			解锁脚本 OP_0 <签名1> ... <签名M> <赎回脚本>
+		签名按公钥在赎回脚本中的顺序排列，OP_0为OP_CHECKMULTISIG多弹出的元素。
+		赎回脚本作为一个元素压栈，不能超过520字节，因此压缩公钥最多15个。
+
+	数据output（null data，用于在交易中保存数据，例如文件哈希）：
+			锁定脚本 OP_RETURN <数据>
+		执行到OP_RETURN时脚本失败，因此可以证明该output无法花费，不放入UTXO集。
+		数据不超过80字节，金额必须为0，每笔交易最多一个数据output。
+*/
+
+//pubKeyHashLen 公钥哈希的字节数
+const pubKeyHashLen = 20
+
+//maxDataCarrierSize 数据output中数据的最大字节数
+const maxDataCarrierSize = 80
+
+//NewP2PKHScript 创建付款给公钥哈希的锁定脚本
+func NewP2PKHScript(pubKeyHash []byte) []byte {
+	script := []byte{OP_DUP, OP_HASH160}
+	script = append(script, pushData(pubKeyHash)...)
+	return append(script, OP_EQUALVERIFY, OP_CHECKSIG)
+}
+
+//NewP2PKHScriptSig 创建P2PKH的解锁脚本：<签名> <公钥>
+func NewP2PKHScriptSig(sig []byte, pubKey []byte) []byte {
+	return append(pushData(sig), pushData(pubKey)...)
+}
+
+//extractPubKeyHash 从P2PKH锁定脚本中取出公钥哈希，不是P2PKH脚本时返回nil
+func extractPubKeyHash(script []byte) []byte {
+	if len(script) != 25 || script[0] != OP_DUP || script[1] != OP_HASH160 || script[2] != pubKeyHashLen ||
+		script[23] != OP_EQUALVERIFY || script[24] != OP_CHECKSIG {
+		return nil
+	}
+	return script[3:23]
+}
+
+//isP2PKHTo 判断锁定脚本是否为付款给pubKeyHash的P2PKH脚本
+func isP2PKHTo(script []byte, pubKeyHash []byte) bool {
+	hash := extractPubKeyHash(script)
+	return hash != nil && bytes.Equal(hash, pubKeyHash)
+}
+
+//NewP2SHScript 创建付款给脚本哈希的锁定脚本
+func NewP2SHScript(scriptHash []byte) []byte {
+	script := []byte{OP_HASH160}
+	script = append(script, pushData(scriptHash)...)
+	return append(script, OP_EQUAL)
+}
+
+//isP2SH 判断锁定脚本是否为P2SH脚本
+func isP2SH(script []byte) bool {
+	return len(script) == 23 && script[0] == OP_HASH160 && script[1] == pubKeyHashLen && script[22] == OP_EQUAL
+}
+
+//scriptHash 计算赎回脚本的哈希（与公钥哈希的计算方式相同：先sha256再ripemd160）
+func scriptHash(script []byte) []byte {
+	return GetPubKeyHashFromPublicKey(script)
+}
+
+//ScriptAddress 由赎回脚本生成P2SH地址
+func ScriptAddress(redeemScript []byte) string {
+	return encodeAddress(scriptHashAddrID, scriptHash(redeemScript))
+}
+
+//NewNullDataScript 创建数据output的锁定脚本：OP_RETURN <数据>
+func NewNullDataScript(data []byte) []byte {
+	return append([]byte{OP_RETURN}, pushData(data)...)
+}
+
+//isUnspendable 判断锁定脚本是否以OP_RETURN开头（无法花费，不放入UTXO集）
+func isUnspendable(script []byte) bool {
+	return len(script) > 0 && script[0] == OP_RETURN
+}
+
+//extractNullData 从数据output的锁定脚本中取出数据，不是标准的数据output时ok为false
+func extractNullData(script []byte) (data []byte, ok bool) {
+	ops, err := parseScript(script)
+	if err != nil || len(ops) == 0 || len(ops) > 2 || ops[0].opcode != OP_RETURN {
+		return nil, false
+	}
+	if len(ops) == 1 {
+		return nil, true
+	}
+	if ops[1].opcode > OP_PUSHDATA4 || len(ops[1].data) > maxDataCarrierSize {
+		return nil, false
+	}
+	return ops[1].data, true
+}
+
+//NewMultisigScript 创建M-of-N多重签名的赎回脚本（公钥按传入的顺序排列）
+func NewMultisigScript(required int, pubKeys [][]byte) ([]byte, error) {
+	if required < 1 || required > len(pubKeys) || len(pubKeys) > 16 {
+		return nil, ErrMultisigParams
+	}
+	script := pushNumber(int64(required))
+	for _, pubKey := range pubKeys {
+		script = append(script, pushData(pubKey)...)
+	}
+	script = append(script, pushNumber(int64(len(pubKeys)))...)
+	script = append(script, OP_CHECKMULTISIG)
+	if len(script) > maxScriptElementSize {
+		return nil, ErrMultisigParams
+	}
+	return script, nil
+}
+
+//parseMultisigScript 解析多重签名的赎回脚本，返回需要的签名个数和公钥，不是多重签名脚本时ok为false
+func parseMultisigScript(script []byte) (required int, pubKeys [][]byte, ok bool) {
+	ops, err := parseScript(script)
+	if err != nil || len(ops) < 4 || ops[len(ops)-1].opcode != OP_CHECKMULTISIG {
+		return 0, nil, false
+	}
+	smallInt := func(op scriptOp) int {
+		if op.opcode < OP_1 || op.opcode > OP_16 {
+			return -1
+		}
+		return int(op.opcode-OP_1) + 1
+	}
+	required = smallInt(ops[0])
+	n := smallInt(ops[len(ops)-2])
+	if required < 1 || n != len(ops)-3 || required > n {
+		return 0, nil, false
+	}
+	for _, op := range ops[1 : len(ops)-2] {
+		if op.opcode == OP_0 || op.opcode > OP_PUSHDATA4 {
+			return 0, nil, false
+		}
+		pubKeys = append(pubKeys, op.data)
+	}
+	return required, pubKeys, true
+}
@@ -0,0 +1,73 @@
+package main
+
+/*
+	区块奖励：
+		区块奖励由区块高度决定，每隔SubsidyHalvingInterval个区块减半，
+		减半64次后奖励为0，因此货币总量有固定的上限。
+		各网络的货币总量由创世块奖励和减半间隔决定（主网为12.5×210000×2，约525万个币），
+		MaxMoney（2100万个币）是所有网络共用的金额上限，只用于拒绝明显无效的金额，
+		因此大于任何网络的货币总量，GetMaxSupply在货币总量超过MaxMoney时返回错误。
+*/
+
+//GetBlockSubsidy 获取指定高度区块的奖励
+func GetBlockSubsidy(height uint64) Amount {
+	params := activeNetParams
+	halvings := height / params.SubsidyHalvingInterval
+	//右移64位及以上结果未定义，直接返回0
+	if halvings >= 64 {
+		return 0
+	}
+	return params.InitialSubsidy >> halvings
+}
+
+//GetIssuedSupply 获取从创世块到指定高度（包含）的区块奖励总和
+func GetIssuedSupply(height uint64) (Amount, error) {
+	params := activeNetParams
+	var total Amount
+	//按减半周期累加，每个周期内的奖励相同
+	for start := uint64(0); start <= height; start += params.SubsidyHalvingInterval {
+		subsidy := GetBlockSubsidy(start)
+		if subsidy == 0 {
+			break
+		}
+		end := start + params.SubsidyHalvingInterval - 1
+		if end > height {
+			end = height
+		}
+		issued, err := MulAmount(subsidy, end-start+1)
+		if err != nil {
+			return 0, err
+		}
+		total, err = AddAmount(total, issued)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+//GetMaxSupply 获取货币总量上限（所有区块奖励的总和），不超过MaxMoney
+func GetMaxSupply() (Amount, error) {
+	params := activeNetParams
+	var total Amount
+	for subsidy := params.InitialSubsidy; subsidy > 0; subsidy >>= 1 {
+		issued, err := MulAmount(subsidy, params.SubsidyHalvingInterval)
+		if err != nil {
+			return 0, err
+		}
+		total, err = AddAmount(total, issued)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if !total.IsValid() {
+		return 0, ErrAmountRange
+	}
+	return total, nil
+}
+
+//GetNextHalvingHeight 获取指定高度之后下一次奖励减半的区块高度
+func GetNextHalvingHeight(height uint64) uint64 {
+	interval := activeNetParams.SubsidyHalvingInterval
+	return (height/interval + 1) * interval
+}
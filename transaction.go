@@ -31,75 +31,113 @@ package main
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/sha256"
-	"encoding/gob"
+	"encoding/binary"
 	"fmt"
-	"math/big"
 	"strings"
 	"time"
 )
 
 //Transaction 交易
 type Transaction struct {
+	Version   uint32     //交易版本
 	TXID      []byte     //交易ID
 	TXInputs  []TXInput  //交易输入(N个)
 	TXOutputs []TXOutput //交易输出（N个）
 	TimeStamp uint64     //创建交易的时间
+	LockTime  uint32     //锁定时间：小于500000000为区块高度，否则为unix时间（秒），未到锁定时间不能放入区块（见lock.go）
 }
 
 //TXInput 交易输入：指明交易发起人可支付资金的来源
 type TXInput struct {
-	TXID       []byte //引用output所在交易的ID
-	Index      int64  //引用output在output集合中的索引值
-	ScriptSign []byte //解锁脚本：付款人对当前新交易的签名
-	PubKey     []byte //解锁脚本：付款人的公钥
+	TXID      []byte //引用output所在交易的ID
+	Index     int64  //引用output在output集合中的索引值
+	ScriptSig []byte //解锁脚本：满足引用output锁定脚本的数据（P2PKH为签名和公钥）
+	Sequence  uint32 //序号：为SequenceFinal时交易的锁定时间不生效，第31位为0时表示相对锁定（见lock.go）
 }
 
+//SequenceFinal input序号的最终值
+const SequenceFinal uint32 = 0xffffffff
+
 //TXOutput 交易输出：包含资金接收方的相关信息，作为下一个交易的输入
 type TXOutput struct {
-	Value            float64 //转账金额
-	ScriptPubKeyHash []byte  //锁定脚本：收款人的公钥哈希（地址）
+	Value        Amount //转账金额（最小单位）
+	ScriptPubKey []byte //锁定脚本：花费该output需要满足的条件（见script.go）
 }
 
 //NewTXOutput 创建一个人output
-func NewTXOutput(address string, amount float64) TXOutput {
+func NewTXOutput(address string, amount Amount) TXOutput {
 	output := TXOutput{
 		Value: amount,
 	}
-	//通过地址获取公钥哈希
-	pubKeyHash := GetPubKeyHashFromAddress(address)
-	output.ScriptPubKeyHash = pubKeyHash
+	//根据地址类型使用P2PKH或P2SH模板锁定
+	output.ScriptPubKey = AddressToScript(address)
 	return output
 }
 
-//获取交易ID：计算交易哈希
-func (tx *Transaction) setHash() error {
-	//对tx进行gob编码获得字节流，然后计算sha256，赋值给TXID
+//获取交易ID：计算交易哈希（二进制格式序列化结果的sha256）
+func (tx *Transaction) setHash() {
+	hash := sha256.Sum256(tx.Serialize())
+	tx.TXID = hash[:]
+}
+
+//Serialize 将交易序列化为字节流（格式见serialize.go）
+func (tx *Transaction) Serialize() []byte {
 	var buffer bytes.Buffer
-	encoder := gob.NewEncoder(&buffer)
-	err := encoder.Encode(tx)
+	tx.encode(&buffer)
+	return buffer.Bytes()
+}
+
+//DeSerializeTransaction 将字节流反序列化为交易
+func DeSerializeTransaction(data []byte) *Transaction {
+	r := bytes.NewReader(data)
+	tx, err := decodeTransaction(r)
+	if err == nil {
+		err = checkTrailing(r)
+	}
 	if err != nil {
 		fmt.Println(err)
-		return err
+		return nil
 	}
-	hash := sha256.Sum256(buffer.Bytes())
-	tx.TXID = hash[:]
-	return nil
+	return tx
 }
 
-//挖矿奖励
-var reward = 12.5
+//computeTXID 按创建交易时的方式重新计算交易ID（交易ID为空、解锁脚本为空时的哈希）
+//挖矿交易的解锁脚本为区块高度和矿工数据，参与交易ID的计算
+func (tx *Transaction) computeTXID() []byte {
+	if tx.isCoinBaseTX() {
+		txCopy := *tx
+		txCopy.TXID = nil
+		txCopy.setHash()
+		return txCopy.TXID
+	}
+
+	txCopy := Transaction{
+		Version:   tx.Version,
+		TXID:      nil,
+		TXOutputs: tx.TXOutputs,
+		TimeStamp: tx.TimeStamp,
+		LockTime:  tx.LockTime,
+	}
+	for _, input := range tx.TXInputs {
+		input.ScriptSig = nil
+		txCopy.TXInputs = append(txCopy.TXInputs, input)
+	}
+	txCopy.setHash()
+	return txCopy.TXID
+}
 
-//NewCoinbaseTX 创建挖矿交易(没有input因此不需要签名，只有一个output获得挖矿奖励)
-func NewCoinbaseTX(miner /*矿工*/ string, data string) *Transaction {
-	input := TXInput{TXID: nil, Index: -1, ScriptSign: nil, PubKey: []byte(data)} //挖矿不需要签名，由矿工任意填写
-	output := NewTXOutput(miner, reward)
+//NewCoinbaseTX 创建挖矿交易(没有input因此不需要签名，只有一个output获得挖矿奖励和区块中交易的手续费)
+//height - 区块高度，决定挖矿奖励，并写入input保证不同区块的挖矿交易ID不同
+func NewCoinbaseTX(miner /*矿工*/ string, data string, height uint64, fees Amount) *Transaction {
+	//挖矿不需要签名，input的解锁脚本为区块高度(8字节)+矿工任意填写的数据（不执行）
+	coinbaseData := append(UintToByteSlice(height), []byte(data)...)
+	input := TXInput{TXID: nil, Index: -1, ScriptSig: coinbaseData, Sequence: SequenceFinal}
+	output := NewTXOutput(miner, GetBlockSubsidy(height)+fees)
 	timStamp := time.Now().Unix()
 
 	tx := Transaction{
+		Version:   TxVersion,
 		TXID:      nil,
 		TXInputs:  []TXInput{input},
 		TXOutputs: []TXOutput{output},
@@ -109,9 +147,27 @@ func NewCoinbaseTX(miner /*矿工*/ string, data string) *Transaction {
 	return &tx
 }
 
+//Payment 收款人及转账金额
+type Payment struct {
+	Address string //收款人地址
+	Amount  Amount //转账金额
+	Data    []byte //不为nil时创建数据output（OP_RETURN），Address为空、Amount为0
+}
+
+//NewDataOutput 创建数据output：金额为0，锁定脚本为OP_RETURN <数据>
+func NewDataOutput(data []byte) TXOutput {
+	return TXOutput{Value: 0, ScriptPubKey: NewNullDataScript(data)}
+}
+
 //NewTransaction 创建普通交易
-//from - 付款人，to - 收款人， amount - 转账金额
-func NewTransaction(from string, to string, amount float64, bc *BlockChain) *Transaction {
+//from - 付款人，to - 收款人， amount - 转账金额，fee - 手续费（输入与输出的差额，由矿工获得），selector - 选币策略，lock - 锁定条件
+func NewTransaction(from string, to string, amount Amount, fee Amount, selector CoinSelector, lock TxLock, bc *BlockChain) *Transaction {
+	return NewTransactionMany(from, []Payment{{Address: to, Amount: amount}}, fee, selector, lock, bc)
+}
+
+//NewTransactionMany 创建向多个收款人转账的交易：每个收款人一个output，付款人找零一个output
+//from - 付款人，payments - 收款人及金额，fee - 手续费，selector - 选币策略，lock - 锁定条件
+func NewTransactionMany(from string, payments []Payment, fee Amount, selector CoinSelector, lock TxLock, bc *BlockChain) *Transaction {
 
 	//钱包在此使用：from -> 钱包 -> 私钥 -> 签名
 	//打开钱包
@@ -123,64 +179,191 @@ func NewTransaction(from string, to string, amount float64, bc *BlockChain) *Tra
 	//找到对应的钱包
 	wallet, ok := wm.Wallets[from]
 	if !ok {
+		if wm.isWatchOnly(from) {
+			fmt.Println(ErrWatchOnly)
+			return nil
+		}
 		fmt.Println("未找到付款人地址对应的私钥")
 		return nil
 	}
-	priKey := wallet.PrivateKey                      //签名使用
-	pubKey := wallet.PublicKey                       //获得公钥
-	pubKeyHash := GetPubKeyHashFromPublicKey(pubKey) //获得公钥哈希
+	script := NewP2PKHScript(GetPubKeyHashFromPublicKey(wallet.PublicKey)) //付款人的锁定脚本
 
-	//遍历账本，找到满足条件的utxo集合，返回utxo集合的总金额
-	var spentUTXO = make(map[string][]int64) //将要使用的uxto集合
-	var retValue float64                     //utxo的总金额
+	//需要的总金额 = 所有转账金额 + 手续费
+	needed, ok := sumPayments(payments, fee)
+	if !ok {
+		return nil
+	}
 
-	//遍历账本，找到from能使用的utxo集合及包含的所有金额
-	spentUTXO, retValue = bc.findNeedUTXO(pubKeyHash, amount)
-	//金额不足
-	if retValue < amount {
-		fmt.Println("金额不足，创建交易失败")
+	//遍历账本，按选币策略找到from将要使用的utxo集合及包含的所有金额
+	utxoInfos, retValue, err := bc.findNeedUTXO(script, needed, selector)
+	if err != nil {
+		fmt.Printf("%v，创建交易失败\n", err)
 		return nil
 	}
 
-	var inputs []TXInput
-	var outputs []TXOutput
-	//拼接inputs
-	//遍历utxo集合，把每个putput转为input
-	for txid, indexArray := range spentUTXO {
-		//遍历获取output的下标值
-		for _, i := range indexArray {
-			input := TXInput{
-				TXID:       []byte(txid),
-				Index:      i,
-				ScriptSign: nil,
-				PubKey:     pubKey,
-			}
-			inputs = append(inputs, input)
+	var coins []walletCoin
+	for _, utxoInfo := range utxoInfos {
+		coins = append(coins, walletCoin{utxoInfo, wallet})
+	}
+	return newSignedTransaction(coins, retValue, payments, needed, from, lock, bc)
+}
+
+//NewWalletTransaction 创建从钱包中任意地址付款的交易：从wallet.dat中所有地址的utxo中选币，每个input使用所属地址的私钥签名
+//payments - 收款人及金额，fee - 手续费，change - 找零地址（为空时找零到HD钱包新的找零地址，没有HD种子时找零给第一个input所属的地址），selector - 选币策略
+func NewWalletTransaction(payments []Payment, fee Amount, change string, selector CoinSelector, bc *BlockChain) *Transaction {
+	wm := NewWalletManager()
+	if wm == nil {
+		fmt.Println("打开钱包失败")
+		return nil
+	}
+
+	needed, ok := sumPayments(payments, fee)
+	if !ok {
+		return nil
+	}
+
+	//收集钱包中所有地址能使用的utxo，记录每个utxo所属的钱包
+	var utxoInfos []UTXOInfo
+	owners := make(map[string]*Wallet) //key为utxoKey
+	for _, address := range wm.listAddresses() {
+		wallet := wm.Wallets[address]
+		script := NewP2PKHScript(GetPubKeyHashFromPublicKey(wallet.PublicKey))
+		for _, utxoInfo := range bc.findSpendableUTXO(script) {
+			utxoInfos = append(utxoInfos, utxoInfo)
+			owners[string(utxoKey(utxoInfo.TXID, utxoInfo.Index))] = wallet
 		}
+	}
 
+	selected, retValue, err := selector.Select(utxoInfos, needed)
+	if err != nil {
+		fmt.Printf("%v，创建交易失败\n", err)
+		return nil
+	}
+	var coins []walletCoin
+	for _, utxoInfo := range selected {
+		coins = append(coins, walletCoin{utxoInfo, owners[string(utxoKey(utxoInfo.TXID, utxoInfo.Index))]})
 	}
 
-	//拼接outputs
-	//创建一个属于to的output
-	output1 := NewTXOutput(to, amount)
-	outputs = append(outputs, output1)
-	if retValue > amount {
-		//如果总金额大于转账金额，找零：给from创建一个output
-		output2 := NewTXOutput(from, retValue-amount)
-		outputs = append(outputs, output2)
+	//HD钱包找零到新的找零地址，否则找零给第一个input所属的地址
+	//派生的找零地址在交易签名成功后才保存，没有找零或创建失败时不消耗找零链的索引
+	derived := false
+	if change == "" && wm.HD != nil && retValue > needed {
+		w, err := wm.nextHDWallet(0, hdInternal)
+		if err != nil {
+			fmt.Println(err)
+			return nil
+		}
+		change = w.getAddress()
+		derived = true
+	}
+	if change == "" {
+		change = coins[0].Wallet.getAddress()
+	}
+	tx := newSignedTransaction(coins, retValue, payments, needed, change, TxLock{}, bc)
+	if tx != nil && derived && !wm.saveFile() {
+		fmt.Println("保存钱包失败")
+		return nil
 	}
+	return tx
+}
 
-	timeStamp := time.Now().Unix()
-	//计算哈希值，返回
-	tx := Transaction{nil, inputs, outputs, uint64(timeStamp)}
-	tx.setHash()
+//sumPayments 计算交易需要的总金额：所有转账金额 + 手续费
+func sumPayments(payments []Payment, fee Amount) (Amount, bool) {
+	if len(payments) == 0 {
+		fmt.Println("没有收款人")
+		return 0, false
+	}
+	needed := fee
+	for _, payment := range payments {
+		if payment.Data != nil {
+			if len(payment.Data) > maxDataCarrierSize {
+				fmt.Printf("数据超过%d字节\n", maxDataCarrierSize)
+				return 0, false
+			}
+			continue
+		}
+		var err error
+		needed, err = AddAmount(needed, payment.Amount)
+		if err != nil || payment.Amount <= 0 || !needed.IsValid() {
+			fmt.Println("转账金额无效")
+			return 0, false
+		}
+	}
+	return needed, true
+}
+
+//walletCoin 将要使用的utxo及其所属的钱包（签名时使用钱包的私钥）
+type walletCoin struct {
+	UTXOInfo
+	Wallet *Wallet
+}
+
+//newSignedTransaction 使用选中的utxo创建交易并签名
+//retValue - utxo的总金额，needed - 转账金额+手续费，多出的部分找零给change，lock - 锁定条件（签名覆盖锁定时间和序号）
+func newSignedTransaction(coins []walletCoin, retValue Amount, payments []Payment, needed Amount, change string, lock TxLock, bc *BlockChain) *Transaction {
+	var inputs []TXInput
+	var signers []*Wallet //每个input对应的签名钱包
+
+	//拼接inputs
+	//遍历utxo集合，把每个output转为input
+	for _, coin := range coins {
+		//钱包的签名方案必须与当前网络一致
+		if coin.Wallet.Scheme != activeNetParams.Scheme.Name() {
+			fmt.Printf("钱包地址%s的签名方案(%s)与区块链的签名方案(%s)不一致，只能在使用%s的区块链上签名\n",
+				coin.Wallet.getAddress(), coin.Wallet.Scheme, activeNetParams.Scheme.Name(), coin.Wallet.Scheme)
+			return nil
+		}
+		//加密的钱包未解锁时没有私钥
+		if coin.Wallet.PrivateKey == nil {
+			fmt.Println(ErrWalletLocked)
+			return nil
+		}
+		input := TXInput{
+			TXID:      coin.TXID,
+			Index:     coin.Index,
+			ScriptSig: nil,
+			Sequence:  SequenceFinal,
+		}
+		inputs = append(inputs, input)
+		signers = append(signers, coin.Wallet)
+	}
+
+	tx := newUnsignedTransaction(inputs, retValue, payments, needed, change, lock)
 
 	//交易签名
-	if !bc.SignTransaction(&tx, priKey) {
+	if !bc.SignTransaction(tx, signers) {
 		fmt.Println("交易签名失败")
 		return nil
 	}
 
+	return tx
+}
+
+//newUnsignedTransaction 使用inputs创建未签名的交易：每个收款人一个output，多出的部分找零给change，按lock设置锁定时间和序号
+func newUnsignedTransaction(inputs []TXInput, retValue Amount, payments []Payment, needed Amount, change string, lock TxLock) *Transaction {
+	var outputs []TXOutput
+
+	//拼接outputs
+	//为每个收款人创建一个output
+	for _, payment := range payments {
+		if payment.Data != nil {
+			outputs = append(outputs, NewDataOutput(payment.Data))
+			continue
+		}
+		outputs = append(outputs, NewTXOutput(payment.Address, payment.Amount))
+	}
+	if retValue > needed {
+		//如果总金额大于转账金额+手续费，找零：给change创建一个output
+		output2 := NewTXOutput(change, retValue-needed)
+		outputs = append(outputs, output2)
+	}
+
+	timeStamp := time.Now().Unix()
+	//计算哈希值，返回
+	tx := Transaction{TxVersion, nil, inputs, outputs, uint64(timeStamp), 0}
+	lock.apply(&tx)
+	//input可能已有待签名的解锁脚本，交易ID按解锁脚本为空计算
+	tx.TXID = tx.computeTXID()
 	return &tx
 }
 
@@ -194,60 +377,79 @@ func (tx *Transaction) isCoinBaseTX() bool {
 	return false
 }
 
-//Sign 实际签名动作(私钥，inputs所引用的output所在交易的集合：key:交易ID,value:交易本身)
-func (tx *Transaction) Sign(priKey *ecdsa.PrivateKey, prevTXs map[string]*Transaction) bool {
+//coinbaseHeight 获取挖矿交易中记录的区块高度
+func (tx *Transaction) coinbaseHeight() (uint64, bool) {
+	data := tx.TXInputs[0].ScriptSig
+	if len(data) < 8 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(data[:8]), true
+}
+
+//coinbaseData 获取挖矿交易中矿工填写的数据（去掉前8字节的区块高度）
+func (tx *Transaction) coinbaseData() []byte {
+	data := tx.TXInputs[0].ScriptSig
+	if len(data) < 8 {
+		return nil
+	}
+	return data[8:]
+}
+
+//Sign 实际签名动作(每个input对应的钱包，inputs所引用的output所在交易的集合：key:交易ID,value:交易本身)
+//signers[i]用于对第i个input签名，input可以来自不同的地址，使用当前网络的签名方案
+//引用的output必须是付款给钱包公钥哈希的P2PKH脚本，解锁脚本为 <签名> <公钥>
+func (tx *Transaction) Sign(signers []*Wallet, prevTXs map[string]*Transaction) bool {
 
 	//挖矿交易不需要签名
 	if tx.isCoinBaseTX() {
 		return true
 	}
+	if len(signers) != len(tx.TXInputs) {
+		fmt.Println("私钥个数与input个数不一致")
+		return false
+	}
 
-	//获取交易副本，置空pubKey和Sign
-	txCopy := tx.trimmedCopy()
 	//遍历inputs
-	for i, input := range txCopy.TXInputs {
+	for i, input := range tx.TXInputs {
 		prevTX := prevTXs[string(input.TXID)]
-		if prevTX == nil {
+		if prevTX == nil || input.Index < 0 || input.Index >= int64(len(prevTX.TXOutputs)) {
 			return false
 		}
 		//input引用的output
 		output := prevTX.TXOutputs[input.Index]
-		//获取引用的output公钥哈希
-		txCopy.TXInputs[i].PubKey = output.ScriptPubKeyHash
-		//对交易副本进行签名
-		txCopy.setHash() //计算交易哈希
-
-		//将input的pubKey字段置空
-		txCopy.TXInputs[i].PubKey = nil //还原数据，防止干扰后面的input签名
+		wallet := signers[i]
+		if !isP2PKHTo(output.ScriptPubKey, GetPubKeyHashFromPublicKey(wallet.PublicKey)) {
+			fmt.Println("引用output的锁定脚本不是付款给该钱包的P2PKH脚本")
+			return false
+		}
 
-		hashData := txCopy.TXID //要签名的数据
-		//签名
-		r, s, err := ecdsa.Sign(rand.Reader, priKey, hashData)
+		hashData := tx.signatureHash(i, output.ScriptPubKey) //要签名的数据
+		//签名（DER编码，s规范为较小的值）
+		signature, err := activeNetParams.Scheme.Sign(wallet.PrivateKey, hashData)
 		if err != nil {
 			fmt.Println("签名失败")
 			return false
 		}
-		signature := append(r.Bytes(), s.Bytes()...)
-		//将数字签名赋值给原始交易
-		tx.TXInputs[i].ScriptSign = signature
+		//将解锁脚本赋值给原始交易
+		tx.TXInputs[i].ScriptSig = NewP2PKHScriptSig(signature, wallet.PublicKey)
 	}
 
 	fmt.Println("交易签名成功")
 	return true
 }
 
-//创建一个交易副本：每个input的pubKey和Sign都置空
+//创建一个交易副本：每个input的解锁脚本都置空
 func (tx *Transaction) trimmedCopy() *Transaction {
 	var inputs []TXInput
 	var outputs []TXOutput
 
-	//每个input的pubKey和Sign都置空
+	//每个input的解锁脚本都置空
 	for _, input := range tx.TXInputs {
 		input := TXInput{
-			TXID:       input.TXID,
-			Index:      input.Index,
-			ScriptSign: nil,
-			PubKey:     nil,
+			TXID:      input.TXID,
+			Index:     input.Index,
+			ScriptSig: nil,
+			Sequence:  input.Sequence,
 		}
 		inputs = append(inputs, input)
 	}
@@ -255,16 +457,26 @@ func (tx *Transaction) trimmedCopy() *Transaction {
 	outputs = tx.TXOutputs
 
 	txCopy := Transaction{
+		tx.Version,
 		tx.TXID,
 		inputs,
 		outputs,
 		tx.TimeStamp,
+		tx.LockTime,
 	}
 
 	return &txCopy
 }
 
-//Verify 校验交易签名实际动作
+//signatureHash 计算第i个input的签名数据：交易副本中第i个input的解锁脚本替换为script（引用output的锁定脚本）后的交易哈希
+func (tx *Transaction) signatureHash(i int, script []byte) []byte {
+	txCopy := tx.trimmedCopy()
+	txCopy.TXInputs[i].ScriptSig = script
+	txCopy.setHash()
+	return txCopy.TXID
+}
+
+//Verify 校验交易签名实际动作：对每个input执行解锁脚本和引用output的锁定脚本
 func (tx *Transaction) Verify(prevTXs map[string]*Transaction) bool {
 
 	//挖矿交易不需要签名
@@ -272,47 +484,21 @@ func (tx *Transaction) Verify(prevTXs map[string]*Transaction) bool {
 		return true
 	}
 
-	//获取交易副本，置空pubKey和Sign
-	txCopy := tx.trimmedCopy()
 	//遍历inputs
 	for i, input := range tx.TXInputs {
 		prevTX := prevTXs[string(input.TXID)]
-		if prevTX == nil {
+		if prevTX == nil || input.Index < 0 || input.Index >= int64(len(prevTX.TXOutputs)) {
 			return false
 		}
-		//还原数据：得到引用  获取交易哈希值
+		//input引用的output
 		output := prevTX.TXOutputs[input.Index]
-		txCopy.TXInputs[i].PubKey = output.ScriptPubKeyHash
-		txCopy.setHash() //计算交易哈希
-
-		//将input的pubKey字段置空
-		txCopy.TXInputs[i].PubKey = nil
-
-		hashData := txCopy.TXID       //要还原的签名的数据
-		signature := input.ScriptSign //签名
-		pubKey := input.PubKey        //公钥字节流
 
-		//开始校验
-		var r, s, x, y big.Int
-
-		//把r和s从签名中截取出来
-		r.SetBytes(signature[:len(signature)/2])
-		s.SetBytes(signature[len(signature)/2:])
-
-		//把x和y从pubKey中截取出来，还原公钥本身
-		x.SetBytes(pubKey[:len(pubKey)/2])
-		y.SetBytes(pubKey[len(pubKey)/2:])
-
-		curve := elliptic.P256()
-		publicKey := ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}
-
-		//校验
-		res := ecdsa.Verify(&publicKey, hashData, &r, &s)
-		if !res {
-			fmt.Println("签名校验失败")
+		//执行脚本：按当前网络的签名方案严格解析公钥和签名
+		err := VerifyScript(input.ScriptSig, output.ScriptPubKey, tx, i)
+		if err != nil {
+			fmt.Printf("input %d: %v\n", i, err)
 			return false
 		}
-
 	}
 
 	fmt.Println("签名校验成功")
@@ -324,20 +510,26 @@ func (tx *Transaction) String() string {
 	var lines []string
 
 	lines = append(lines, fmt.Sprintf("Transaction %x:", tx.TXID))
+	lines = append(lines, fmt.Sprintf("Version: %d", tx.Version))
+	lines = append(lines, fmt.Sprintf("LockTime: %d", tx.LockTime))
 
 	for i, input := range tx.TXInputs {
 
 		lines = append(lines, fmt.Sprintf("Input %d:", i))
 		lines = append(lines, fmt.Sprintf("TXID: %x", input.TXID))
 		lines = append(lines, fmt.Sprintf("Out: %d", input.Index))
-		lines = append(lines, fmt.Sprintf("Signature: %x", input.ScriptSign))
-		lines = append(lines, fmt.Sprintf("PubKey: %x", input.PubKey))
+		if tx.isCoinBaseTX() {
+			lines = append(lines, fmt.Sprintf("Coinbase: %x", input.ScriptSig))
+		} else {
+			lines = append(lines, fmt.Sprintf("ScriptSig: %s", DisasmScript(input.ScriptSig)))
+		}
+		lines = append(lines, fmt.Sprintf("Sequence: %d", input.Sequence))
 	}
 
 	for i, output := range tx.TXOutputs {
 		lines = append(lines, fmt.Sprintf("Output %d:", i))
-		lines = append(lines, fmt.Sprintf("Value: %f", output.Value))
-		lines = append(lines, fmt.Sprintf("Script: %x", output.ScriptPubKeyHash))
+		lines = append(lines, fmt.Sprintf("Value: %s", output.Value))
+		lines = append(lines, fmt.Sprintf("Script: %s", DisasmScript(output.ScriptPubKey)))
 	}
 
 	return strings.Join(lines, "\n")
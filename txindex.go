@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/boltdb/bolt"
+)
+
+/*
+	交易索引：
+		key为交易ID，value为交易所在区块的哈希+交易在区块中的位置，
+		根据交易ID查找交易时直接定位区块，不再遍历账本。
+*/
+
+//交易索引数据桶
+const txIndexBucket = "txIndexBucket"
+
+//TXLocation 交易在账本中的位置
+type TXLocation struct {
+	BlockHash []byte //所在区块的哈希值
+	Position  int64  //在区块交易集合中的索引值
+}
+
+//updateTXIndex 将区块中的所有交易写入交易索引
+func updateTXIndex(bucket *bolt.Bucket, block *Block) error {
+	for i, tx := range block.Transactions {
+		value := append(append([]byte{}, block.Hash...), UintToByteSlice(uint64(i))...)
+		err := bucket.Put(tx.TXID, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//findTXLocation 在数据库事务中查询交易位置，没有找到返回nil
+func findTXLocation(tx *bolt.Tx, txid []byte) *TXLocation {
+	bucket := tx.Bucket([]byte(txIndexBucket))
+	if bucket == nil {
+		return nil
+	}
+	value := bucket.Get(txid)
+	if len(value) < 8 {
+		return nil
+	}
+	blockHash := make([]byte, len(value)-8)
+	copy(blockHash, value[:len(value)-8])
+	position := binary.LittleEndian.Uint64(value[len(value)-8:])
+	return &TXLocation{blockHash, int64(position)}
+}
+
+//getBlock 在数据库事务中根据哈希读取区块
+func getBlock(tx *bolt.Tx, hash []byte) *Block {
+	bucket := tx.Bucket([]byte(blockBucket))
+	if bucket == nil {
+		return nil
+	}
+	data := bucket.Get(hash)
+	if data == nil {
+		return nil
+	}
+	return DeSerialize(data)
+}
+
+//findTransaction 在数据库事务中根据交易ID获取交易及其位置
+func findTransaction(tx *bolt.Tx, txid []byte) (*Transaction, *TXLocation) {
+	location := findTXLocation(tx, txid)
+	if location == nil {
+		return nil, nil
+	}
+	block := getBlock(tx, location.BlockHash)
+	if block == nil || location.Position >= int64(len(block.Transactions)) {
+		return nil, nil
+	}
+	return block.Transactions[location.Position], location
+}
+
+//FindTransaction 根据交易ID获取交易
+func (bc *BlockChain) FindTransaction(txid []byte) *Transaction {
+	var transaction *Transaction
+	bc.db.View(func(tx *bolt.Tx) error {
+		transaction, _ = findTransaction(tx, txid)
+		return nil
+	})
+	return transaction
+}
+
+//GetTransaction 根据交易ID获取交易及其所在位置
+func (bc *BlockChain) GetTransaction(txid []byte) (*Transaction, *TXLocation, error) {
+	var transaction *Transaction
+	var location *TXLocation
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(txIndexBucket)) == nil {
+			return errors.New("交易索引不存在，请执行reindextx")
+		}
+		transaction, location = findTransaction(tx, txid)
+		if transaction == nil {
+			return errors.New("没有找到交易")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return transaction, location, nil
+}
+
+//ReindexTransactions 遍历账本重建交易索引
+func (bc *BlockChain) ReindexTransactions() (int, error) {
+	var count int //交易个数
+
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		//删除旧的交易索引
+		if tx.Bucket([]byte(txIndexBucket)) != nil {
+			err := tx.DeleteBucket([]byte(txIndexBucket))
+			if err != nil {
+				return err
+			}
+		}
+		bucket, err := tx.CreateBucket([]byte(txIndexBucket))
+		if err != nil {
+			return err
+		}
+
+		//使用当前的写事务遍历区块（在写事务中再打开读事务可能死锁）
+		for hash := bc.tail; len(hash) != 0; {
+			block := getBlock(tx, hash)
+			if block == nil {
+				return errors.New("读取区块失败")
+			}
+			err := updateTXIndex(bucket, block)
+			if err != nil {
+				return err
+			}
+			count += len(block.Transactions)
+			hash = block.PrevHash
+		}
+		return nil
+	})
+	return count, err
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+/*
+	UTXO集：
+		数据库中单独保存所有未消费的输出，key为交易ID+output索引，value为output本身。
+		无法花费的数据output（OP_RETURN）不放入UTXO集。
+		添加区块时与区块在同一个数据库事务中更新，查询余额和选择utxo时不再遍历账本。
+*/
+
+//UTXO集数据桶
+const utxoBucket = "utxoBucket"
+
+//UTXOInfo UTXO详情
+type UTXOInfo struct {
+	TXID     []byte //交易ID
+	Index    int64  //索引值
+	TXOutput        //继承自output
+}
+
+//utxoKey 生成UTXO集中的key：交易ID+output索引
+func utxoKey(txid []byte, index int64) []byte {
+	key := make([]byte, 0, len(txid)+8)
+	key = append(key, txid...)
+	return append(key, UintToByteSlice(uint64(index))...)
+}
+
+//parseUTXOKey 从UTXO集的key中解析交易ID和output索引
+func parseUTXOKey(key []byte) ([]byte, int64) {
+	txid := make([]byte, len(key)-8)
+	copy(txid, key[:len(key)-8])
+	index := binary.LittleEndian.Uint64(key[len(key)-8:]) //与UintToByteSlice一致，小端对齐
+	return txid, int64(index)
+}
+
+//serializeTXOutput 将output序列化为字节流（格式见serialize.go）
+func serializeTXOutput(output TXOutput) ([]byte, error) {
+	var buffer bytes.Buffer
+	output.encode(&buffer)
+	return buffer.Bytes(), nil
+}
+
+//deSerializeTXOutput 将字节流反序列化为output
+func deSerializeTXOutput(data []byte) (TXOutput, error) {
+	r := bytes.NewReader(data)
+	output, err := decodeTXOutput(r)
+	if err == nil {
+		err = checkTrailing(r)
+	}
+	return output, err
+}
+
+//updateUTXOSet 根据新区块更新UTXO集：删除被inputs消耗的output，添加新产生的output
+func updateUTXOSet(bucket *bolt.Bucket, block *Block) error {
+	for _, tx := range block.Transactions {
+		//删除已消耗的utxo（挖矿交易没有引用的output）
+		if !tx.isCoinBaseTX() {
+			for _, input := range tx.TXInputs {
+				err := bucket.Delete(utxoKey(input.TXID, input.Index))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		//添加新的utxo（跳过数据output）
+		for outputIndex, output := range tx.TXOutputs {
+			if isUnspendable(output.ScriptPubKey) {
+				continue
+			}
+			data, err := serializeTXOutput(output)
+			if err != nil {
+				return err
+			}
+			err = bucket.Put(utxoKey(tx.TXID, int64(outputIndex)), data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//FindMyUTXO 获取锁定脚本为script的utxo：查询UTXO集（script由地址生成，见AddressToScript）
+func (bc *BlockChain) FindMyUTXO(script []byte) []UTXOInfo {
+	var utxoInfos []UTXOInfo //UTXO集合
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(utxoBucket))
+		if bucket == nil {
+			return errors.New("UTXO集不存在，请执行reindexutxo")
+		}
+		//遍历UTXO集，找到锁定脚本为目标脚本的output
+		return bucket.ForEach(func(k, v []byte) error {
+			output, err := deSerializeTXOutput(v)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(output.ScriptPubKey, script) {
+				return nil
+			}
+			txid, index := parseUTXOKey(k)
+			utxoInfos = append(utxoInfos, UTXOInfo{txid, index, output})
+			return nil
+		})
+	})
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	return utxoInfos
+}
+
+//ReindexUTXO 遍历账本重建UTXO集
+func (bc *BlockChain) ReindexUTXO() (int, error) {
+	var count int //utxo个数
+
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		//删除旧的UTXO集
+		if tx.Bucket([]byte(utxoBucket)) != nil {
+			err := tx.DeleteBucket([]byte(utxoBucket))
+			if err != nil {
+				return err
+			}
+		}
+		bucket, err := tx.CreateBucket([]byte(utxoBucket))
+		if err != nil {
+			return err
+		}
+
+		var spentUtxos = make(map[string]bool) //已消耗的output（key为utxoKey）
+
+		//从最后一个区块向前遍历，后面区块的inputs先于被引用的outputs出现
+		//使用当前的写事务遍历区块（在写事务中再打开读事务可能死锁）
+		for hash := bc.tail; len(hash) != 0; {
+			block := getBlock(tx, hash)
+			if block == nil {
+				return errors.New("读取区块失败")
+			}
+			//同一区块中后面的交易可能引用前面交易的output，因此倒序遍历交易
+			for i := len(block.Transactions) - 1; i >= 0; i-- {
+				blockTX := block.Transactions[i]
+				for outputIndex, output := range blockTX.TXOutputs {
+					key := utxoKey(blockTX.TXID, int64(outputIndex))
+					if spentUtxos[string(key)] || isUnspendable(output.ScriptPubKey) {
+						continue
+					}
+					data, err := serializeTXOutput(output)
+					if err != nil {
+						return err
+					}
+					err = bucket.Put(key, data)
+					if err != nil {
+						return err
+					}
+					count++
+				}
+
+				if blockTX.isCoinBaseTX() {
+					continue
+				}
+				for _, input := range blockTX.TXInputs {
+					spentUtxos[string(utxoKey(input.TXID, input.Index))] = true
+				}
+			}
+			hash = block.PrevHash
+		}
+		return nil
+	})
+	return count, err
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+/*
+	区块校验：
+		区块写入数据库之前必须通过以下共识规则，任何一条不满足都拒绝该区块：
+			0. 区块和其中的交易使用当前版本的格式（旧版本只存在于转换后的历史数据中）
+			1. 前区块哈希为最后一个区块的哈希，高度为最后一个区块高度+1，
+			   时间戳大于最近11个区块时间戳的中位数，且不超过当前时间2小时
+			   （难度调整和按时间的锁定都依赖时间戳，不能由矿工任意回拨或提前）
+			2. 难度为难度调整规则要求的难度，工作量证明有效，且区块哈希与区块头计算的结果一致
+			3. 梅克尔根与区块中的交易一致
+			4. 第一笔交易是挖矿交易，且只有一笔挖矿交易，记录的高度与区块高度一致，
+			   奖励不超过上限（由区块高度决定的区块奖励+区块中交易的手续费）
+			5. 每笔普通交易引用的output都存在且未被消耗（包括区块内的双花）
+			6. 每笔普通交易的签名有效，输入金额不小于输出金额
+			7. 每个output的金额不为负数且不超过金额上限MaxMoney，金额求和不溢出
+			8. 每笔交易已到锁定时间，且满足每个input的相对锁定（见lock.go）
+			9. 以OP_RETURN开头的output为标准的数据output（数据不超过80字节，金额为0），每笔交易最多一个
+*/
+
+//区块校验错误：每条共识规则对应一个错误
+var (
+	ErrBlockNoTransactions    = errors.New("区块没有交易")
+	ErrBlockBadVersion        = errors.New("区块版本无效")
+	ErrBlockBadPrevHash       = errors.New("前区块哈希与最后一个区块不匹配")
+	ErrBlockBadHeight         = errors.New("区块高度错误")
+	ErrBlockTimeTooOld        = errors.New("区块时间戳不大于最近11个区块的中位时间")
+	ErrBlockTimeTooNew        = errors.New("区块时间戳超过当前时间2小时")
+	ErrBlockBadBits           = errors.New("区块难度与要求的难度不一致")
+	ErrBlockBadProofOfWork    = errors.New("工作量证明无效")
+	ErrBlockBadHash           = errors.New("区块哈希与区块头不匹配")
+	ErrBlockBadMerkleRoot     = errors.New("梅克尔根与交易不匹配")
+	ErrBlockNoCoinbase        = errors.New("第一笔交易不是挖矿交易")
+	ErrBlockMultipleCoinbase  = errors.New("区块包含多笔挖矿交易")
+	ErrBlockBadCoinbaseValue  = errors.New("挖矿奖励超过上限")
+	ErrBlockBadCoinbaseHeight = errors.New("挖矿交易记录的高度与区块高度不一致")
+	ErrTXBadVersion           = errors.New("交易版本无效")
+	ErrTXBadID                = errors.New("交易ID与交易内容不匹配")
+	ErrTXDuplicate            = errors.New("交易ID与未完全消耗的交易重复")
+	ErrTXNoInputs             = errors.New("交易没有输入")
+	ErrTXNoOutputs            = errors.New("交易没有输出")
+	ErrTXMissingInput         = errors.New("引用的output不存在或已被消耗")
+	ErrTXDoubleSpend          = errors.New("区块内重复消耗同一个output")
+	ErrTXBadSignature         = errors.New("交易签名无效")
+	ErrTXInsufficientInputs   = errors.New("输入金额小于输出金额")
+	ErrTXBadOutputValue       = errors.New("output金额为负数或超过金额上限")
+	ErrTXNotFinal             = errors.New("交易未到锁定时间")
+	ErrTXSequenceLock         = errors.New("交易未满足input的相对锁定")
+	ErrTXBadDataOutput        = errors.New("数据output格式无效、金额不为0或超过一个")
+)
+
+//区块时间戳最多超过当前时间的时长
+const maxFutureBlockTime = 2 * time.Hour
+
+//计算中位时间使用的区块个数
+const medianTimeBlocks = 11
+
+//medianTimestamp 在数据库事务中计算以block结尾的最近11个区块时间戳（纳秒）的中位数
+func medianTimestamp(tx *bolt.Tx, block *Block) uint64 {
+	var times []uint64
+	for b := block; b != nil && len(times) < medianTimeBlocks; {
+		times = append(times, b.TimeStamp)
+		if b.PrevHash == nil {
+			break
+		}
+		b = getBlock(tx, b.PrevHash)
+	}
+	if len(times) == 0 {
+		return 0
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times[len(times)/2]
+}
+
+//GetMedianTimestamp 计算最后11个区块时间戳的中位数，新区块的时间戳必须大于该值
+func (bc *BlockChain) GetMedianTimestamp() (uint64, error) {
+	var median uint64
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		prevBlock := getBlock(tx, bc.tail)
+		if prevBlock == nil {
+			return errors.New("读取最后一个区块失败")
+		}
+		median = medianTimestamp(tx, prevBlock)
+		return nil
+	})
+	return median, err
+}
+
+//utxoView 校验区块时使用的UTXO视图：数据库中的UTXO集叠加区块内已处理交易的变化
+type utxoView struct {
+	utxos   *bolt.Bucket            //数据库中的UTXO集
+	created map[string]TXOutput     //区块内新产生的output（key为utxoKey）
+	spent   map[string]bool         //区块内已消耗的output（key为utxoKey）
+	txs     map[string]*Transaction //区块内已处理的交易（key为交易ID）
+}
+
+//newUTXOView 创建UTXO视图
+func newUTXOView(tx *bolt.Tx) (*utxoView, error) {
+	utxos := tx.Bucket([]byte(utxoBucket))
+	if utxos == nil {
+		return nil, errors.New("UTXO集不存在，请执行reindexutxo")
+	}
+	view := utxoView{
+		utxos:   utxos,
+		created: make(map[string]TXOutput),
+		spent:   make(map[string]bool),
+		txs:     make(map[string]*Transaction),
+	}
+	return &view, nil
+}
+
+//lookup 查询未消耗的output
+func (view *utxoView) lookup(txid []byte, index int64) (TXOutput, bool) {
+	key := string(utxoKey(txid, index))
+	if view.spent[key] {
+		return TXOutput{}, false
+	}
+	if output, ok := view.created[key]; ok {
+		return output, true
+	}
+	data := view.utxos.Get([]byte(key))
+	if data == nil {
+		return TXOutput{}, false
+	}
+	output, err := deSerializeTXOutput(data)
+	if err != nil {
+		return TXOutput{}, false
+	}
+	return output, true
+}
+
+//hasUnspent 判断交易是否还有未消耗的output
+func (view *utxoView) hasUnspent(tx *Transaction) bool {
+	for i := range tx.TXOutputs {
+		if _, ok := view.lookup(tx.TXID, int64(i)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+//apply 将交易的inputs和outputs应用到视图
+func (view *utxoView) apply(tx *Transaction) {
+	if !tx.isCoinBaseTX() {
+		for _, input := range tx.TXInputs {
+			view.spent[string(utxoKey(input.TXID, input.Index))] = true
+		}
+	}
+	for i, output := range tx.TXOutputs {
+		if isUnspendable(output.ScriptPubKey) {
+			continue
+		}
+		view.created[string(utxoKey(tx.TXID, int64(i)))] = output
+	}
+	view.txs[string(tx.TXID)] = tx
+}
+
+//ValidateBlock 校验区块是否可以接在最后一个区块之后
+func (bc *BlockChain) ValidateBlock(block *Block) error {
+	return bc.db.View(func(tx *bolt.Tx) error {
+		return validateBlock(tx, bc.tail, block)
+	})
+}
+
+//validateBlock 在数据库事务中校验区块的共识规则
+func validateBlock(tx *bolt.Tx, tail []byte, block *Block) error {
+	if len(block.Transactions) == 0 {
+		return ErrBlockNoTransactions
+	}
+	if block.Version != BlockVersion {
+		return ErrBlockBadVersion
+	}
+
+	//前区块哈希和高度
+	if !bytes.Equal(block.PrevHash, tail) {
+		return ErrBlockBadPrevHash
+	}
+	prevBlock := getBlock(tx, tail)
+	if prevBlock == nil {
+		return errors.New("读取最后一个区块失败")
+	}
+	if block.Height != prevBlock.Height+1 {
+		return ErrBlockBadHeight
+	}
+
+	//时间戳
+	if block.TimeStamp <= medianTimestamp(tx, prevBlock) {
+		return ErrBlockTimeTooOld
+	}
+	if block.TimeStamp > uint64(time.Now().Add(maxFutureBlockTime).UnixNano()) {
+		return ErrBlockTimeTooNew
+	}
+
+	//难度
+	bits, err := calcNextBits(tx, prevBlock)
+	if err != nil {
+		return err
+	}
+	if block.Bits != bits {
+		return ErrBlockBadBits
+	}
+
+	//工作量证明
+	pow := NewProofOfWork(block)
+	if !pow.IsValid() {
+		return ErrBlockBadProofOfWork
+	}
+	hash := sha256.Sum256(pow.PrepareData(block.Nonce))
+	if !bytes.Equal(hash[:], block.Hash) {
+		return ErrBlockBadHash
+	}
+
+	//梅克尔根
+	if !bytes.Equal(ComputeMerkleRoot(block.txids()), block.MerkleRoot) {
+		return ErrBlockBadMerkleRoot
+	}
+
+	//挖矿交易
+	coinbase := block.Transactions[0]
+	if !coinbase.isCoinBaseTX() {
+		return ErrBlockNoCoinbase
+	}
+	if height, ok := coinbase.coinbaseHeight(); !ok || height != block.Height {
+		return ErrBlockBadCoinbaseHeight
+	}
+
+	//普通交易
+	view, err := newUTXOView(tx)
+	if err != nil {
+		return err
+	}
+	var fees Amount //区块中所有交易的手续费
+	for i, blockTX := range block.Transactions {
+		if i > 0 && blockTX.isCoinBaseTX() {
+			return ErrBlockMultipleCoinbase
+		}
+		fee, err := validateTransaction(tx, view, blockTX)
+		if err != nil {
+			return fmt.Errorf("交易%x: %w", blockTX.TXID, err)
+		}
+		err = checkTransactionLocks(tx, view, blockTX, block.Height, prevBlock)
+		if err != nil {
+			return fmt.Errorf("交易%x: %w", blockTX.TXID, err)
+		}
+		fees, err = AddAmount(fees, fee)
+		if err != nil || !fees.IsValid() {
+			return fmt.Errorf("交易%x: %w", blockTX.TXID, ErrTXBadOutputValue)
+		}
+		view.apply(blockTX)
+	}
+
+	//挖矿奖励不能超过区块奖励+手续费
+	coinbaseValue, err := sumOutputs(coinbase)
+	if err != nil {
+		return err
+	}
+	if coinbaseValue > GetBlockSubsidy(block.Height)+fees {
+		return ErrBlockBadCoinbaseValue
+	}
+	return nil
+}
+
+//validateTransaction 根据UTXO视图校验交易，返回交易的手续费（输入金额-输出金额）
+func validateTransaction(tx *bolt.Tx, view *utxoView, transaction *Transaction) (Amount, error) {
+	//旧版本交易的ID和签名依赖gob编码，无法重新校验
+	if transaction.Version != TxVersion {
+		return 0, ErrTXBadVersion
+	}
+	if len(transaction.TXInputs) == 0 {
+		return 0, ErrTXNoInputs
+	}
+	if len(transaction.TXOutputs) == 0 {
+		return 0, ErrTXNoOutputs
+	}
+	if !bytes.Equal(transaction.computeTXID(), transaction.TXID) {
+		return 0, ErrTXBadID
+	}
+
+	//交易ID不能与未完全消耗的交易重复，否则会覆盖其utxo
+	if existing, _ := findTransaction(tx, transaction.TXID); existing != nil && view.hasUnspent(existing) {
+		return 0, ErrTXDuplicate
+	}
+	if existing := view.txs[string(transaction.TXID)]; existing != nil && view.hasUnspent(existing) {
+		return 0, ErrTXDuplicate
+	}
+
+	//output金额
+	outputValue, err := sumOutputs(transaction)
+	if err != nil {
+		return 0, err
+	}
+	//数据output
+	err = checkDataOutputs(transaction)
+	if err != nil {
+		return 0, err
+	}
+
+	//挖矿交易没有引用的output
+	if transaction.isCoinBaseTX() {
+		return 0, nil
+	}
+
+	var inputValue Amount
+	prevTXs := make(map[string]*Transaction)
+	spent := make(map[string]bool) //交易内引用的output
+	for _, input := range transaction.TXInputs {
+		key := string(utxoKey(input.TXID, input.Index))
+		if spent[key] {
+			return 0, ErrTXDoubleSpend
+		}
+		spent[key] = true
+
+		output, ok := view.lookup(input.TXID, input.Index)
+		if !ok {
+			if view.spent[key] {
+				return 0, ErrTXDoubleSpend
+			}
+			return 0, ErrTXMissingInput
+		}
+		inputValue, err = AddAmount(inputValue, output.Value)
+		if err != nil || !inputValue.IsValid() {
+			return 0, ErrTXBadOutputValue
+		}
+
+		//签名校验需要引用的交易
+		prevTX := view.txs[string(input.TXID)]
+		if prevTX == nil {
+			prevTX, _ = findTransaction(tx, input.TXID)
+		}
+		if prevTX == nil {
+			return 0, ErrTXMissingInput
+		}
+		prevTXs[string(input.TXID)] = prevTX
+	}
+
+	if !transaction.Verify(prevTXs) {
+		return 0, ErrTXBadSignature
+	}
+
+	if inputValue < outputValue {
+		return 0, ErrTXInsufficientInputs
+	}
+	return inputValue - outputValue, nil
+}
+
+//checkDataOutputs 校验交易中以OP_RETURN开头的output：标准格式、金额为0，最多一个
+func checkDataOutputs(transaction *Transaction) error {
+	count := 0
+	for _, output := range transaction.TXOutputs {
+		if !isUnspendable(output.ScriptPubKey) {
+			continue
+		}
+		count++
+		if _, ok := extractNullData(output.ScriptPubKey); !ok || output.Value != 0 || count > 1 {
+			return ErrTXBadDataOutput
+		}
+	}
+	return nil
+}
+
+//sumOutputs 计算交易所有output的金额之和，并校验每个output和总额的范围
+func sumOutputs(transaction *Transaction) (Amount, error) {
+	var total Amount
+	for _, output := range transaction.TXOutputs {
+		if !output.Value.IsValid() {
+			return 0, ErrTXBadOutputValue
+		}
+		var err error
+		total, err = AddAmount(total, output.Value)
+		if err != nil || !total.IsValid() {
+			return 0, ErrTXBadOutputValue
+		}
+	}
+	return total, nil
+}
@@ -2,9 +2,6 @@ package main
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/sha256"
 	"fmt"
 
@@ -14,50 +11,82 @@ import (
 
 //Wallet 钱包
 type Wallet struct {
-	PrivateKey *ecdsa.PrivateKey //私钥
-	//X,Y类型一致，将X和Y拼接成字节流赋值给publicKey字段用于传输
-	//验证时将X和Y截取出来再创建一条曲线，还原公钥以进行校验
-	PublicKey []byte //公钥
+	Scheme     string //签名方案（创建钱包时网络使用的方案）
+	PrivateKey []byte //私钥（32字节，钱包加密后只在解锁时存在于内存中）
+	//公钥使用SEC1编码（默认为压缩格式：前缀+X）赋值给publicKey字段用于传输
+	//验证时解析出X和Y（压缩格式由X计算Y），还原公钥以进行校验
+	PublicKey    []byte //公钥
+	EncryptedKey []byte //加密后的私钥（钱包未加密时为空）
+	HDPath       string //HD钱包的派生路径（为空时为随机生成或导入的独立私钥）
+	Label        string //标签（导入私钥时填写）
 }
 
-//NewWalletKeyPair 创建钱包：密钥对
-func NewWalletKeyPair() *Wallet {
+//NewWalletKeyPair 创建钱包：使用当前网络的签名方案生成密钥对（compressed为false时公钥使用未压缩格式）
+func NewWalletKeyPair(compressed bool) *Wallet {
+	scheme := activeNetParams.Scheme
 	//创建私钥
-	curve := elliptic.P256()                                 //创建曲线
-	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader) //生成私钥
+	privateKey, err := scheme.GenerateKey()
 	if err != nil {
 		fmt.Println(err)
 		return nil
 	}
 
-	//通过私钥获得公钥
-	publicKey := privateKey.PublicKey
-
-	//将公钥的X,Y进行拼接
-	pubKey := append(publicKey.X.Bytes(), publicKey.Y.Bytes()...)
+	//通过私钥获得SEC1编码的公钥，地址由编码后的公钥计算
+	pubKey, err := scheme.PublicKey(privateKey, compressed)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
 
 	//返回
-	wallet := Wallet{privateKey, pubKey}
+	wallet := Wallet{Scheme: scheme.Name(), PrivateKey: privateKey, PublicKey: pubKey}
 	return &wallet
 }
 
+//地址版本（地址的第一个字节）
+const (
+	pubKeyHashAddrID = 0x00 //P2PKH地址：公钥哈希
+	scriptHashAddrID = 0x05 //P2SH地址：赎回脚本的哈希
+)
+
 //根据私钥生成地址
 func (w *Wallet) getAddress() string {
 
 	//获得公钥哈希
 	pubKeyHash := GetPubKeyHashFromPublicKey(w.PublicKey)
 
-	//拼接version和公钥哈希，得到21字节的数据
-	payload := append([]byte{byte(0x00)}, pubKeyHash...)
+	return encodeAddress(pubKeyHashAddrID, pubKeyHash)
+}
+
+//encodeAddress 拼接version和哈希，加上校验码后进行base58编码
+func encodeAddress(version byte, hash []byte) string {
+	//拼接version和哈希，得到21字节的数据
+	payload := append([]byte{version}, hash...)
 
 	//生成4个字节的校验码
 	checksum := CheckSum(payload)
 	//25字节数据
 	payload = append(payload, checksum...)
 	//地址
-	address := base58.Encode(payload)
+	return base58.Encode(payload)
+}
 
-	return address
+//AddressToScript 根据地址创建锁定脚本：P2PKH地址付款给公钥哈希，P2SH地址付款给赎回脚本的哈希
+func AddressToScript(address string) []byte {
+	deInfo := base58.Decode(address)
+	if len(deInfo) != 25 {
+		fmt.Println("地址无效")
+		return nil
+	}
+	hash := deInfo[1 : len(deInfo)-4]
+	switch deInfo[0] {
+	case pubKeyHashAddrID:
+		return NewP2PKHScript(hash)
+	case scriptHashAddrID:
+		return NewP2SHScript(hash)
+	}
+	fmt.Println("地址版本无效")
+	return nil
 }
 
 //GetPubKeyHashFromPublicKey 通过公钥计算公钥哈希
@@ -108,6 +137,11 @@ func IsValidAddress(address string) bool {
 		fmt.Println("地址校验失败")
 		return false
 	}
+	//只接受P2PKH和P2SH地址
+	if deInfo[0] != pubKeyHashAddrID && deInfo[0] != scriptHashAddrID {
+		fmt.Println("地址版本无效")
+		return false
+	}
 	//截取前21字节的payload
 	payload := deInfo[:len(deInfo)-4]
 	//截取后4字节的checksum1
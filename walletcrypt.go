@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+/*
+	钱包加密：
+		encryptwallet使用密码加密wallet.dat中的私钥，加密后不能再恢复为明文：
+			1. 随机生成16字节的盐，使用scrypt(密码, 盐, N=32768, r=8, p=1)派生32字节的密钥
+			2. 每个私钥使用AES-256-GCM加密，随机的12字节nonce放在密文前面，
+			   公钥作为附加数据，密文不能挪给其他地址使用
+			3. 用同一个密钥加密一段固定的校验数据，解锁时用来判断密码是否正确
+		HD钱包的种子使用同样的方式加密（没有附加数据）。
+		加密后wallet.dat中只保存私钥和种子的密文，地址、公钥和赎回脚本仍为明文，
+		查询余额和地址不需要密码，签名和创建地址（需要加密新的私钥）需要先解锁。
+	解锁：
+		命令行的每条命令都是独立的进程，钱包密钥不写入磁盘，解锁状态分成两部分保存：
+			walletpassphrase随机生成本次解锁的32字节密钥，只写入wallet.unlock（权限0600）；
+			钱包密钥用随机密钥加密（过期时间作为附加数据，不能被修改）后保存在wallet.dat中。
+		有效期内的命令用wallet.unlock中的随机密钥解密出钱包密钥，再解密私钥，
+		单独复制wallet.unlock或wallet.dat都不能得到钱包密钥；
+		walletlock、重新解锁和过期后的第一条命令会删除wallet.unlock并清除wallet.dat中的解锁状态。
+		有效期内同时能读取两个文件的人仍然可以使用私钥，超时时间应尽量短。
+*/
+
+//钱包加密错误
+var (
+	ErrWalletLocked     = errors.New("钱包已锁定，请先执行walletpassphrase解锁")
+	ErrWalletEncrypted  = errors.New("钱包已加密")
+	ErrWalletPlaintext  = errors.New("钱包没有加密，请先执行encryptwallet")
+	ErrWalletPassphrase = errors.New("钱包密码错误")
+)
+
+//解锁状态文件
+const walletUnlockFile = "wallet.unlock"
+
+//scrypt参数
+const (
+	walletScryptN  = 1 << 15
+	walletScryptR  = 8
+	walletScryptP  = 1
+	walletKeyLen   = 32
+	walletSaltSize = 16
+)
+
+//校验数据：解锁时解密成功说明密码正确
+var walletCheckData = []byte("wallet passphrase check")
+
+//WalletEncryption 钱包加密参数
+type WalletEncryption struct {
+	Salt  []byte //scrypt的盐
+	N     int    //scrypt参数
+	R     int
+	P     int
+	Check []byte //校验数据的密文
+}
+
+//WalletUnlock 解锁状态（保存在wallet.dat中）：用本次解锁的随机密钥加密的钱包密钥和过期时间（unix时间，秒）
+type WalletUnlock struct {
+	Wrapped []byte
+	Expiry  int64
+}
+
+//deriveKey 使用scrypt由密码派生加密私钥的密钥
+func (enc *WalletEncryption) deriveKey(passphrase []byte) ([]byte, error) {
+	return scrypt.Key(passphrase, enc.Salt, enc.N, enc.R, enc.P, walletKeyLen)
+}
+
+//sealData 使用AES-256-GCM加密，返回nonce+密文，ad为附加数据（不加密，但参与认证）
+func sealData(key []byte, plaintext []byte, ad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+//openData 解密sealData的结果，密钥错误或数据被修改时返回错误
+func openData(key []byte, data []byte, ad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("密文长度无效")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], ad)
+}
+
+//isEncrypted 判断钱包是否已加密
+func (wm *WalletManager) isEncrypted() bool {
+	return wm.Encryption != nil
+}
+
+//isLocked 判断钱包是否已加密且未解锁（私钥不可用）
+func (wm *WalletManager) isLocked() bool {
+	return wm.isEncrypted() && wm.key == nil
+}
+
+//encrypt 使用密码加密所有私钥并保存，加密后钱包处于锁定状态
+func (wm *WalletManager) encrypt(passphrase []byte) error {
+	if wm.isEncrypted() {
+		return ErrWalletEncrypted
+	}
+	enc := WalletEncryption{
+		Salt: make([]byte, walletSaltSize),
+		N:    walletScryptN,
+		R:    walletScryptR,
+		P:    walletScryptP,
+	}
+	if _, err := rand.Read(enc.Salt); err != nil {
+		return err
+	}
+	key, err := enc.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+	enc.Check, err = sealData(key, walletCheckData, nil)
+	if err != nil {
+		return err
+	}
+	for _, w := range wm.Wallets {
+		w.EncryptedKey, err = sealData(key, w.PrivateKey, w.PublicKey)
+		if err != nil {
+			return err
+		}
+	}
+	if wm.HD != nil {
+		wm.HD.EncryptedSeed, err = sealData(key, wm.HD.Seed, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	wm.Encryption = &enc
+	if !wm.saveFile() {
+		return errors.New("保存钱包失败")
+	}
+	//之前的解锁状态不再有效
+	return wm.walletLock()
+}
+
+//unlock 使用派生的密钥解密所有私钥（只在内存中）
+func (wm *WalletManager) unlock(key []byte) error {
+	if !wm.isEncrypted() {
+		return ErrWalletPlaintext
+	}
+	if _, err := openData(key, wm.Encryption.Check, nil); err != nil {
+		return ErrWalletPassphrase
+	}
+	for address, w := range wm.Wallets {
+		privateKey, err := openData(key, w.EncryptedKey, w.PublicKey)
+		if err != nil {
+			return fmt.Errorf("解密钱包地址%s的私钥失败: %v", address, err)
+		}
+		w.PrivateKey = privateKey
+	}
+	if wm.HD != nil {
+		seed, err := openData(key, wm.HD.EncryptedSeed, nil)
+		if err != nil {
+			return fmt.Errorf("解密HD种子失败: %v", err)
+		}
+		wm.HD.Seed = seed
+	}
+	wm.key = key
+	return nil
+}
+
+//lockKeys 清除内存中的明文私钥和密钥
+func (wm *WalletManager) lockKeys() {
+	for _, w := range wm.Wallets {
+		w.PrivateKey = nil
+	}
+	if wm.HD != nil {
+		wm.HD.Seed = nil
+	}
+	wm.key = nil
+}
+
+//walletPassphrase 使用密码解锁钱包，timeout后解锁状态失效
+func (wm *WalletManager) walletPassphrase(passphrase []byte, timeout time.Duration) error {
+	if !wm.isEncrypted() {
+		return ErrWalletPlaintext
+	}
+	key, err := wm.Encryption.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+	err = wm.unlock(key)
+	if err != nil {
+		return err
+	}
+
+	//本次解锁的随机密钥，只保存在wallet.unlock中
+	secret := make([]byte, walletKeyLen)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	expiry := time.Now().Add(timeout).Unix()
+	wrapped, err := sealData(secret, key, UintToByteSlice(uint64(expiry)))
+	if err != nil {
+		return err
+	}
+	wm.Unlock = &WalletUnlock{Wrapped: wrapped, Expiry: expiry}
+	if !wm.saveFile() {
+		return errors.New("保存钱包失败")
+	}
+	return ioutil.WriteFile(walletUnlockFile, secret, 0600)
+}
+
+//walletLock 立即锁定钱包：删除wallet.unlock并清除wallet.dat中的解锁状态
+func (wm *WalletManager) walletLock() error {
+	wm.lockKeys()
+	err := os.Remove(walletUnlockFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if wm.Unlock != nil {
+		wm.Unlock = nil
+		if !wm.saveFile() {
+			return errors.New("保存钱包失败")
+		}
+	}
+	return nil
+}
+
+//loadUnlock 读取解锁状态，未过期时解密私钥，过期或无效时锁定钱包
+func (wm *WalletManager) loadUnlock() {
+	if !wm.isEncrypted() || (wm.Unlock == nil && !IsFileExist(walletUnlockFile)) {
+		return
+	}
+	if wm.Unlock != nil && time.Now().Unix() < wm.Unlock.Expiry {
+		secret, err := ioutil.ReadFile(walletUnlockFile)
+		if err == nil {
+			key, err := openData(secret, wm.Unlock.Wrapped, UintToByteSlice(uint64(wm.Unlock.Expiry)))
+			if err == nil && wm.unlock(key) == nil {
+				return
+			}
+		}
+	}
+	wm.walletLock()
+}
+
+//readPassphrase 从标准输入读取一行作为密码
+func readPassphrase(r *bufio.Reader, prompt string) ([]byte, error) {
+	fmt.Print(prompt)
+	line, err := r.ReadString('\n')
+	if err != nil && line == "" {
+		return nil, errors.New("读取密码失败")
+	}
+	passphrase := strings.TrimRight(line, "\r\n")
+	if passphrase == "" {
+		return nil, errors.New("密码不能为空")
+	}
+	return []byte(passphrase), nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"crypto/ecdsa"
 	"crypto/elliptic"
 	"encoding/gob"
 	"fmt"
@@ -12,7 +13,14 @@ import (
 //WalletManager 钱包管理：对外管理生成的钱包（公钥,私钥）
 //私钥 -> 公钥 -> 地址
 type WalletManager struct {
-	Wallets map[string]*Wallet //管理所有钱包的map(key为地址,value为钱包)
+	Wallets    map[string]*Wallet    //管理所有钱包的map(key为地址,value为钱包)
+	Scripts    map[string][]byte     //多重签名地址的赎回脚本(key为P2SH地址)
+	Encryption *WalletEncryption     //钱包加密参数（为nil时私钥为明文，见walletcrypt.go）
+	HD         *HDChain              //HD钱包的种子和派生状态（为nil时没有HD种子，见hd.go）
+	WatchOnly  map[string]*WatchOnly //只读地址(key为地址，没有私钥，见watchonly.go)
+	Unlock     *WalletUnlock         //解锁状态（为nil时未解锁，见walletcrypt.go）
+
+	key []byte //解锁后派生的密钥（不保存到文件）
 }
 
 //NewWalletManager 创建WalletManager
@@ -22,23 +30,46 @@ func NewWalletManager() *WalletManager {
 
 	//创建钱包map
 	wm.Wallets = make(map[string]*Wallet)
+	wm.Scripts = make(map[string][]byte)
+	wm.WatchOnly = make(map[string]*WatchOnly)
 
 	//从磁盘加载已创建的钱包到map
 	if !wm.loadFile() {
 		return nil
 	}
+	//已加密的钱包在解锁有效期内解密私钥
+	wm.loadUnlock()
 
 	//返回钱包map
 	return &wm
 }
 
-func (wm *WalletManager) createWallet() string {
+//创建钱包，返回地址：默认从HD种子派生account账户的下一个收款地址（没有种子时先生成助记词），
+//compressed为false时创建随机的独立私钥，公钥使用未压缩格式（不能由助记词恢复）
+func (wm *WalletManager) createWallet(compressed bool, account uint32) string {
+	//加密的钱包需要解锁后才能加密新的私钥
+	if wm.isLocked() {
+		fmt.Println(ErrWalletLocked)
+		return ""
+	}
+	if compressed && activeNetParams.Scheme.Name() == SchemeSecp256k1 {
+		return wm.createHDWallet(account)
+	}
+
 	//创密钥对
-	w := NewWalletKeyPair()
+	w := NewWalletKeyPair(compressed)
 	if w == nil {
 		fmt.Println("钱包密钥对创建失败")
 		return ""
 	}
+	if wm.isEncrypted() {
+		var err error
+		w.EncryptedKey, err = sealData(wm.key, w.PrivateKey, w.PublicKey)
+		if err != nil {
+			fmt.Println(err)
+			return ""
+		}
+	}
 
 	//获取地址
 	address := w.getAddress()
@@ -56,6 +87,38 @@ func (wm *WalletManager) createWallet() string {
 
 }
 
+//createHDWallet 从HD种子派生新的收款地址，没有种子时生成助记词
+func (wm *WalletManager) createHDWallet(account uint32) string {
+	if wm.HD == nil {
+		mnemonic, err := newMnemonic()
+		if err != nil {
+			fmt.Println(err)
+			return ""
+		}
+		seed, err := mnemonicToSeed(mnemonic)
+		if err != nil {
+			fmt.Println(err)
+			return ""
+		}
+		err = wm.initHDChain(seed)
+		if err != nil {
+			fmt.Println(err)
+			return ""
+		}
+		fmt.Println("已生成HD钱包的助记词，请抄写并妥善保管，之后创建的地址都可以由助记词恢复:")
+		fmt.Println(mnemonic)
+		if len(wm.Wallets) > 0 {
+			fmt.Println("钱包中已有的随机地址不能由助记词恢复，请继续备份wallet.dat")
+		}
+	}
+	address, err := wm.newHDAddress(account, hdExternal)
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	return address
+}
+
 //钱包文件
 const walletFile = "wallet.dat"
 
@@ -64,12 +127,25 @@ func (wm *WalletManager) saveFile() bool {
 	//使用gob对wm进行编码
 	var buffer bytes.Buffer
 
-	//注册椭圆曲线的接口函数后才能进行编码
-	gob.Register(elliptic.P256())
+	//加密的钱包不保存明文私钥和种子
+	data := wm
+	if wm.isEncrypted() {
+		data = &WalletManager{Wallets: make(map[string]*Wallet), Scripts: wm.Scripts, Encryption: wm.Encryption, WatchOnly: wm.WatchOnly, Unlock: wm.Unlock}
+		for address, w := range wm.Wallets {
+			stripped := *w
+			stripped.PrivateKey = nil
+			data.Wallets[address] = &stripped
+		}
+		if wm.HD != nil {
+			stripped := *wm.HD
+			stripped.Seed = nil
+			data.HD = &stripped
+		}
+	}
 
 	//编码
 	encoder := gob.NewEncoder(&buffer)
-	err := encoder.Encode(wm)
+	err := encoder.Encode(data)
 	if err != nil {
 		fmt.Println(err)
 		return false
@@ -102,16 +178,65 @@ func (wm *WalletManager) loadFile() bool {
 	//创建解码器
 	decoder := gob.NewDecoder(bytes.NewReader(content))
 
-	//注册椭圆曲线的接口函数后才能进行解码
-	gob.Register(elliptic.P256())
-
 	//解码并赋值到wm
 	err = decoder.Decode(wm)
 	if err != nil {
-		fmt.Println(err)
+		//旧版本的钱包文件，转换后重新保存
+		if !wm.loadLegacyFile(content) {
+			fmt.Println(err)
+			return false
+		}
+		return wm.saveFile()
+	}
+
+	return true
+}
+
+//旧格式地址的标签：公钥为X||Y，只用于转出资金
+const legacyAddressLabel = "旧格式地址"
+
+//旧版本的钱包：私钥为gob编码的ecdsa.PrivateKey（P256曲线）
+type legacyWallet struct {
+	PrivateKey *ecdsa.PrivateKey
+	PublicKey  []byte
+}
+
+//loadLegacyFile 读取旧版本的钱包文件：私钥转换为32字节，
+//最初的公钥为X||Y（没有前缀），转换为未压缩格式的SEC1编码（0x04||X||Y），地址随之改变，
+//旧地址作为单独的钱包保留（公钥仍为X||Y），旧地址上的资金可以用send转到新地址
+func (wm *WalletManager) loadLegacyFile(content []byte) bool {
+	var legacy struct {
+		Wallets map[string]*legacyWallet
+	}
+	//注册椭圆曲线的接口函数后才能进行解码
+	gob.Register(elliptic.P256())
+	err := gob.NewDecoder(bytes.NewReader(content)).Decode(&legacy)
+	if err != nil {
 		return false
 	}
 
+	for _, lw := range legacy.Wallets {
+		w := Wallet{
+			Scheme:     SchemeP256,
+			PrivateKey: paddedBytes(lw.PrivateKey.D, 32),
+			PublicKey:  lw.PublicKey,
+		}
+		if _, err := parsePublicKey(elliptic.P256(), w.PublicKey); err != nil {
+			old := w
+			old.Label = legacyAddressLabel
+			wm.Wallets[old.getAddress()] = &old
+			w.PublicKey = encodePublicKey(&lw.PrivateKey.PublicKey, false)
+			fmt.Printf("钱包地址%s的公钥为旧格式，新地址: %s，请将旧地址的资金转到新地址: send %s %s <amount>\n",
+				old.getAddress(), w.getAddress(), old.getAddress(), w.getAddress())
+		}
+		wm.Wallets[w.getAddress()] = &w
+	}
+	fmt.Println("已转换旧版本的钱包文件")
+	if activeNetParams.Scheme.Name() != SchemeP256 {
+		fmt.Printf("旧钱包的私钥使用P256曲线，当前区块链的签名方案为%s，这些地址不能签名：\n"+
+			"请使用migratedb转换的旧区块链，或设置环境变量%s=%s后创建区块链\n",
+			activeNetParams.Scheme.Name(), schemeEnv, SchemeP256)
+	}
 	return true
 }
 
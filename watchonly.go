@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"sort"
+)
+
+/*
+	只读地址（watch-only）：
+		importaddress导入地址（P2PKH或P2SH）或公钥，钱包只保存地址（和公钥），没有私钥，
+		可以查询余额和收支记录，不能签名：
+			只读地址保存在WatchOnly中而不是Wallets中，sendfromwallet不会选用只读地址的utxo，
+			send、sendmany、notarize、dumpprivkey指定只读地址时返回ErrWatchOnly。
+		导入公钥时保存P2PKH地址和公钥，getpubkey可以查询公钥，用于创建多重签名地址。
+		钱包中已有私钥或赎回脚本的地址不能再导入为只读地址（余额和收支记录中已经单独统计）。
+		只读地址没有需要加密的数据，不受钱包加密和锁定的影响；
+		之后导入该地址的私钥时，只读地址转为普通地址。
+*/
+
+//ErrWatchOnly 只读地址不能签名
+var ErrWatchOnly = errors.New("该地址为只读地址，钱包中没有私钥，不能签名")
+
+//WatchOnly 只读地址
+type WatchOnly struct {
+	PublicKey []byte //公钥（导入地址时为空）
+	Label     string //标签
+}
+
+//importWatchOnly 导入只读地址或公钥（十六进制）并保存钱包，返回地址
+func (wm *WalletManager) importWatchOnly(addressOrPubKey string, label string) (string, error) {
+	var watch WatchOnly
+	address := addressOrPubKey
+	pubKey, err := hex.DecodeString(addressOrPubKey)
+	if err == nil && activeNetParams.Scheme.CheckPublicKey(pubKey) == nil {
+		//公钥：保存对应的P2PKH地址
+		watch.PublicKey = pubKey
+		address = encodeAddress(pubKeyHashAddrID, GetPubKeyHashFromPublicKey(pubKey))
+	} else if !IsValidAddress(addressOrPubKey) {
+		return "", errors.New("地址或公钥无效: " + addressOrPubKey)
+	}
+	watch.Label = label
+
+	if _, ok := wm.Wallets[address]; ok {
+		return address, errors.New("钱包中已有该地址的私钥: " + address)
+	}
+	if _, ok := wm.Scripts[address]; ok {
+		return address, errors.New("钱包中已有该多重签名地址的赎回脚本: " + address)
+	}
+	if _, ok := wm.WatchOnly[address]; ok {
+		return address, errors.New("只读地址已在钱包中: " + address)
+	}
+	wm.WatchOnly[address] = &watch
+	if !wm.saveFile() {
+		return "", errors.New("保存钱包失败")
+	}
+	return address, nil
+}
+
+//isWatchOnly 判断地址是否为只读地址
+func (wm *WalletManager) isWatchOnly(address string) bool {
+	_, ok := wm.WatchOnly[address]
+	return ok
+}
+
+//listWatchOnly 获取所有只读地址
+func (wm *WalletManager) listWatchOnly() []string {
+	var addresses []string
+	for address := range wm.WatchOnly {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/btcsuite/btcutil/base58"
+)
+
+/*
+	WIF（wallet import format，私钥导入格式）：
+		版本(1字节) + 私钥(32字节) + [0x01，公钥为压缩格式时] + 校验码(4字节，两次sha256的前4字节)，再进行base58编码。
+		版本由网络决定（主网0x80，测试网络0xef），导入时版本必须与当前网络一致。
+		只用于当前网络的签名方案，导入的私钥作为独立的密钥保存（不属于HD种子）。
+*/
+
+//WIF错误
+var (
+	ErrWIFInvalid  = errors.New("WIF私钥格式无效或校验码错误")
+	ErrWIFNetwork  = errors.New("WIF私钥不属于当前网络")
+	ErrWalletNoKey = errors.New("钱包中没有该地址的私钥")
+)
+
+//wifCompressed 公钥为压缩格式的标记
+const wifCompressed = 0x01
+
+//EncodeWIF 将私钥编码为WIF格式
+func EncodeWIF(privateKey []byte, compressed bool) string {
+	payload := append([]byte{activeNetParams.PrivateKeyID}, privateKey...)
+	if compressed {
+		payload = append(payload, wifCompressed)
+	}
+	return base58.Encode(append(payload, CheckSum(payload)...))
+}
+
+//DecodeWIF 解码WIF格式的私钥，返回私钥和公钥是否为压缩格式
+func DecodeWIF(wif string) ([]byte, bool, error) {
+	data := base58.Decode(wif)
+	if len(data) != 1+32+4 && len(data) != 1+32+1+4 {
+		return nil, false, ErrWIFInvalid
+	}
+	payload := data[:len(data)-4]
+	if !bytes.Equal(CheckSum(payload), data[len(data)-4:]) {
+		return nil, false, ErrWIFInvalid
+	}
+	if payload[0] != activeNetParams.PrivateKeyID {
+		return nil, false, ErrWIFNetwork
+	}
+	compressed := len(payload) == 1+32+1
+	if compressed && payload[33] != wifCompressed {
+		return nil, false, ErrWIFInvalid
+	}
+	return payload[1:33], compressed, nil
+}
+
+//dumpPrivateKey 导出地址的私钥（WIF格式），加密的钱包需要先解锁
+func (wm *WalletManager) dumpPrivateKey(address string) (string, error) {
+	w, ok := wm.Wallets[address]
+	if !ok {
+		if wm.isWatchOnly(address) {
+			return "", ErrWatchOnly
+		}
+		return "", ErrWalletNoKey
+	}
+	if w.Scheme != activeNetParams.Scheme.Name() {
+		return "", errors.New("钱包地址的签名方案与当前网络不一致")
+	}
+	if w.PrivateKey == nil {
+		return "", ErrWalletLocked
+	}
+	//只有33字节的公钥为压缩格式（旧格式地址的公钥为X||Y，按未压缩格式导出）
+	return EncodeWIF(w.PrivateKey, len(w.PublicKey) == 1+32), nil
+}
+
+//importPrivateKey 导入WIF格式的私钥并保存钱包，返回地址，加密的钱包需要先解锁
+func (wm *WalletManager) importPrivateKey(wif string, label string) (string, error) {
+	privateKey, compressed, err := DecodeWIF(wif)
+	if err != nil {
+		return "", err
+	}
+	if wm.isLocked() {
+		return "", ErrWalletLocked
+	}
+	pubKey, err := activeNetParams.Scheme.PublicKey(privateKey, compressed)
+	if err != nil {
+		return "", err
+	}
+	w := Wallet{
+		Scheme:     activeNetParams.Scheme.Name(),
+		PrivateKey: privateKey,
+		PublicKey:  pubKey,
+		Label:      label,
+	}
+	address := w.getAddress()
+	if _, ok := wm.Wallets[address]; ok {
+		return address, errors.New("地址已在钱包中: " + address)
+	}
+	if wm.isEncrypted() {
+		w.EncryptedKey, err = sealData(wm.key, w.PrivateKey, w.PublicKey)
+		if err != nil {
+			return "", err
+		}
+	}
+	//只读地址转为普通地址，没有指定标签时保留只读地址的标签
+	if watch, ok := wm.WatchOnly[address]; ok {
+		if w.Label == "" {
+			w.Label = watch.Label
+		}
+		delete(wm.WatchOnly, address)
+	}
+	wm.Wallets[address] = &w
+	if !wm.saveFile() {
+		return "", errors.New("保存钱包失败")
+	}
+	return address, nil
+}